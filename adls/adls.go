@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/filesystem"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azdatalake/service"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type ADLSConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *service.Client
+}
+
+type Options struct {
+	// AccountURL is the DFS endpoint of the storage account, e.g.
+	// https://<account>.dfs.core.windows.net/.
+	AccountURL string `json:"account_url"`
+	// FileSystems restricts the sync to these file systems. Every file
+	// system of the account is synced by default.
+	FileSystems []string `json:"file_systems"`
+	// Prefix is the directory listed in each file system, the root by
+	// default.
+	Prefix string `json:"prefix"`
+	// Recursive walks the subdirectories of Prefix. Only its direct
+	// children are listed otherwise.
+	Recursive  bool  `json:"recursive"`
+	MaxResults int32 `json:"max_results"`
+	// ConnectionString, or AccountName and AccountKey, authenticate with
+	// a shared key. The default Azure credential chain is used otherwise.
+	ConnectionString string `json:"connection_string"`
+	AccountName      string `json:"account_name"`
+	AccountKey       string `json:"account_key"`
+}
+
+func (a *ADLSConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		a.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	a.client, err = newClient(opts)
+	if err != nil {
+		a.logger.Error("Failed to create Data Lake client", "error", err)
+		return fmt.Errorf("failed to create Data Lake client: %w", err)
+	}
+
+	fileSystems := opts.FileSystems
+	if fileSystems == nil {
+		fileSystems, err = a.listFileSystems(ctx)
+		if err != nil {
+			a.logger.Warn("Failed to list file systems", "error", err)
+			return err
+		}
+	}
+
+	var errs []error
+	for _, fs := range fileSystems {
+		if err := a.listPaths(ctx, fs, opts, cb); err != nil {
+			a.logger.Warn("Failed to sync file system", "file_system", fs, "error", err)
+			errs = append(errs, fmt.Errorf("file system %s: %w", fs, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newClient builds a client from the first configured authentication method.
+func newClient(opts Options) (*service.Client, error) {
+	if opts.ConnectionString != "" {
+		return service.NewClientFromConnectionString(opts.ConnectionString, nil)
+	}
+	if opts.AccountURL == "" {
+		return nil, errors.New("account_url is required without a connection_string")
+	}
+	if opts.AccountName != "" && opts.AccountKey != "" {
+		cred, err := azdatalake.NewSharedKeyCredential(opts.AccountName, opts.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		return service.NewClientWithSharedKeyCredential(opts.AccountURL, cred, nil)
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	return service.NewClient(opts.AccountURL, cred, nil)
+}
+
+func (a *ADLSConnector) listFileSystems(ctx context.Context) ([]string, error) {
+	res := []string{}
+	p := a.client.NewListFileSystemsPager(nil)
+	for p.More() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, fs := range page.FileSystemItems {
+			if fs.Name == nil {
+				continue
+			}
+			res = append(res, *fs.Name)
+		}
+	}
+	return res, nil
+}
+
+func (a *ADLSConnector) listPaths(ctx context.Context, fs string, opts Options, cb plugin.CallbackHandler) error {
+	params := &filesystem.ListPathsOptions{}
+	if opts.Prefix != "" {
+		params.Prefix = &opts.Prefix
+	}
+	if opts.MaxResults > 0 {
+		params.MaxResults = &opts.MaxResults
+	}
+	client := a.client.NewFileSystemClient(fs)
+	baseURL := strings.TrimSuffix(client.DFSURL(), "/")
+
+	p := client.NewListPathsPager(opts.Recursive, params)
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	var i int
+	for p.More() {
+		i++
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get page %v: %w", i, err)
+		}
+
+		batch.Grow(len(page.Paths))
+		for _, path := range page.Paths {
+			if path.Name == nil {
+				continue
+			}
+			uri := baseURL + "/" + *path.Name
+			lastModified, size := "", ""
+			if path.LastModified != nil {
+				// The DFS API reports RFC1123 dates.
+				if t, err := time.Parse(time.RFC1123, *path.LastModified); err == nil {
+					lastModified = t.Format(time.RFC3339)
+				} else {
+					lastModified = *path.LastModified
+				}
+			}
+			if path.ContentLength != nil {
+				size = strconv.FormatInt(*path.ContentLength, 10)
+			}
+			isDirectory := path.IsDirectory != nil && *path.IsDirectory
+
+			err := batch.Add(&proto.DataObject{
+				RemoteId:     uri,
+				ResourceName: *path.Name,
+				Uri:          uri,
+				Metadata: map[string]string{
+					"last_modified": lastModified,
+					"size":          size,
+					"is_directory":  strconv.FormatBool(isDirectory),
+				}})
+			if err != nil {
+				return err
+			}
+		}
+		if err := batch.EndPage(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &ADLSConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
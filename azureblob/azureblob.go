@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type AzureBlobConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *azblob.Client
+}
+
+type Options struct {
+	// AccountURL is the blob service URL, e.g.
+	// https://<account>.blob.core.windows.net/.
+	AccountURL string   `json:"account_url"`
+	Containers []string `json:"containers"`
+	Prefix     string   `json:"prefix"`
+	MaxResults int32    `json:"max_results"`
+	// ConnectionString, or AccountName and AccountKey, authenticate with
+	// a shared key. The default Azure credential chain is used otherwise.
+	ConnectionString string `json:"connection_string"`
+	AccountName      string `json:"account_name"`
+	AccountKey       string `json:"account_key"`
+}
+
+func (a *AzureBlobConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		a.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+
+	ctx := a.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	a.client, err = newClient(opts)
+	if err != nil {
+		a.logger.Error("Failed to create Azure Blob client", "error", err)
+		return fmt.Errorf("failed to create Azure Blob client: %w", err)
+	}
+
+	containers := opts.Containers
+	if containers == nil {
+		containers, err = a.listContainers(ctx)
+		if err != nil {
+			a.logger.Warn("Failed to list containers", "error", err)
+			return err
+		}
+	}
+
+	var errs []error
+	for _, container := range containers {
+		if err := a.listBlobs(ctx, container, opts, cb); err != nil {
+			a.logger.Warn("Failed to sync container", "container", container, "error", err)
+			errs = append(errs, fmt.Errorf("container %s: %w", container, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newClient builds a client from the first configured authentication method.
+func newClient(opts Options) (*azblob.Client, error) {
+	if opts.ConnectionString != "" {
+		return azblob.NewClientFromConnectionString(opts.ConnectionString, nil)
+	}
+	if opts.AccountURL == "" {
+		return nil, errors.New("account_url is required without a connection_string")
+	}
+	if opts.AccountName != "" && opts.AccountKey != "" {
+		cred, err := azblob.NewSharedKeyCredential(opts.AccountName, opts.AccountKey)
+		if err != nil {
+			return nil, err
+		}
+		return azblob.NewClientWithSharedKeyCredential(opts.AccountURL, cred, nil)
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, err
+	}
+	return azblob.NewClient(opts.AccountURL, cred, nil)
+}
+
+func (a *AzureBlobConnector) listContainers(ctx context.Context) ([]string, error) {
+	res := []string{}
+	p := a.client.NewListContainersPager(nil)
+	for p.More() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, container := range page.ContainerItems {
+			if container.Name == nil {
+				continue
+			}
+			res = append(res, *container.Name)
+		}
+	}
+	return res, nil
+}
+
+func (a *AzureBlobConnector) listBlobs(ctx context.Context, container string, opts Options, cb plugin.CallbackHandler) error {
+	params := &azblob.ListBlobsFlatOptions{}
+	if opts.Prefix != "" {
+		params.Prefix = &opts.Prefix
+	}
+	if opts.MaxResults > 0 {
+		params.MaxResults = &opts.MaxResults
+	}
+	baseURL := strings.TrimSuffix(a.client.URL(), "/")
+
+	p := a.client.NewListBlobsFlatPager(container, params)
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	var i int
+	for p.More() {
+		i++
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get page %v: %w", i, err)
+		}
+		if page.Segment == nil {
+			continue
+		}
+
+		batch.Grow(len(page.Segment.BlobItems))
+		for _, blob := range page.Segment.BlobItems {
+			if blob.Name == nil {
+				continue
+			}
+			uri := blobURL(baseURL, container, *blob.Name)
+			lastModified, size, contentType := "", "", ""
+			if props := blob.Properties; props != nil {
+				if props.LastModified != nil {
+					lastModified = props.LastModified.Format(time.RFC3339)
+				}
+				if props.ContentLength != nil {
+					size = strconv.FormatInt(*props.ContentLength, 10)
+				}
+				if props.ContentType != nil {
+					contentType = *props.ContentType
+				}
+			}
+
+			err := batch.Add(&proto.DataObject{
+				RemoteId:     uri,
+				ResourceName: *blob.Name,
+				Uri:          uri,
+				Metadata: map[string]string{
+					"last_modified": lastModified,
+					"size":          size,
+					"content_type":  contentType,
+				}})
+			if err != nil {
+				return err
+			}
+		}
+		if err := batch.EndPage(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blobURL returns the URL of a blob, with each segment of its name escaped.
+func blobURL(baseURL, container, name string) string {
+	segments := strings.Split(name, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return baseURL + "/" + url.PathEscape(container) + "/" + strings.Join(segments, "/")
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &AzureBlobConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
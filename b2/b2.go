@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Backblaze/blazer/b2"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type B2Connector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *b2.Client
+}
+
+type Options struct {
+	// KeyID and ApplicationKey are a B2 application key. They default to
+	// B2_APPLICATION_KEY_ID and B2_APPLICATION_KEY.
+	KeyID          string `json:"key_id"`
+	ApplicationKey string `json:"application_key"`
+	// Buckets restricts the catalog to these buckets. Every bucket the key
+	// can list is synced by default.
+	Buckets []string `json:"buckets"`
+	// Prefix restricts the catalog to file names starting with it.
+	Prefix string `json:"prefix"`
+	// MaxFilesPerBucket stops the listing of a bucket after that many
+	// files. Zero means no limit.
+	MaxFilesPerBucket int `json:"max_files_per_bucket"`
+}
+
+// batchSize is the number of DataObjects sent per callback. It is also the
+// page size of the file listing.
+const batchSize = 1000
+
+func (c *B2Connector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		c.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.KeyID == "" {
+		opts.KeyID = os.Getenv("B2_APPLICATION_KEY_ID")
+	}
+	if opts.ApplicationKey == "" {
+		opts.ApplicationKey = os.Getenv("B2_APPLICATION_KEY")
+	}
+	if opts.KeyID == "" || opts.ApplicationKey == "" {
+		return errors.New("invalid options: key_id and application_key are required")
+	}
+	if opts.MaxFilesPerBucket < 0 {
+		return fmt.Errorf("invalid options: max_files_per_bucket must not be negative, got %d", opts.MaxFilesPerBucket)
+	}
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	c.client, err = b2.NewClient(ctx, opts.KeyID, opts.ApplicationKey)
+	if err != nil {
+		c.logger.Error("Failed to authorize B2 account", "error", err)
+		return fmt.Errorf("failed to authorize B2 account: %w", err)
+	}
+
+	var buckets []*b2.Bucket
+	if opts.Buckets == nil {
+		buckets, err = c.client.ListBuckets(ctx)
+		if err != nil {
+			c.logger.Warn("Failed to list buckets", "error", err)
+			return err
+		}
+	} else {
+		for _, name := range opts.Buckets {
+			bucket, err := c.client.Bucket(ctx, name)
+			if err != nil {
+				return fmt.Errorf("bucket %s: %w", name, err)
+			}
+			buckets = append(buckets, bucket)
+		}
+	}
+
+	var errs []error
+	for _, bucket := range buckets {
+		if err := c.listFiles(ctx, bucket, opts, cb); err != nil {
+			c.logger.Warn("Failed to list files", "bucket", bucket.Name(), "error", err)
+			errs = append(errs, fmt.Errorf("bucket %s: %w", bucket.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *B2Connector) listFiles(ctx context.Context, bucket *b2.Bucket, opts Options, cb plugin.CallbackHandler) error {
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+
+	listOptions := []b2.ListOption{b2.ListPageSize(batchSize)}
+	if opts.Prefix != "" {
+		listOptions = append(listOptions, b2.ListPrefix(opts.Prefix))
+	}
+	count := 0
+	iter := bucket.List(ctx, listOptions...)
+	for iter.Next() {
+		obj := iter.Object()
+		// Listed files carry their info, so Attrs makes no request.
+		attrs, err := obj.Attrs(ctx)
+		if err != nil {
+			return errors.Join(err, batch.Flush())
+		}
+		if attrs.Status != b2.Uploaded {
+			continue
+		}
+
+		metadata := map[string]string{
+			"size":             strconv.FormatInt(attrs.Size, 10),
+			"upload_timestamp": attrs.UploadTimestamp.UTC().Format(time.RFC3339),
+			"content_type":     attrs.ContentType,
+			"sha1":             attrs.SHA1,
+			"file_id":          obj.ID(),
+		}
+		if !attrs.LastModified.IsZero() {
+			metadata["last_modified"] = attrs.LastModified.UTC().Format(time.RFC3339)
+		}
+		for key, value := range attrs.Info {
+			metadata["info:"+key] = value
+		}
+
+		err = batch.Add(&proto.DataObject{
+			RemoteId:     "b2://" + bucket.Name() + "/" + obj.Name(),
+			ResourceName: obj.Name(),
+			Uri:          downloadURL(bucket, obj.Name()),
+			Metadata:     metadata})
+		if err != nil {
+			return err
+		}
+		count++
+		if opts.MaxFilesPerBucket > 0 && count >= opts.MaxFilesPerBucket {
+			c.logger.Info("Reached max_files_per_bucket", "bucket", bucket.Name(), "files", count)
+			return batch.Flush()
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return errors.Join(err, batch.Flush())
+	}
+	return batch.Flush()
+}
+
+// downloadURL returns the friendly download URL of a file, which requires
+// an authorization token for private buckets.
+func downloadURL(bucket *b2.Bucket, name string) string {
+	segments := strings.Split(name, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return bucket.BaseURL() + "/file/" + url.PathEscape(bucket.Name()) + "/" + strings.Join(segments, "/")
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &B2Connector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+type BigQueryConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *bigquery.Client
+}
+
+type Options struct {
+	Project string `json:"project"`
+	// Datasets restricts the catalog to these datasets. Every dataset of
+	// the project is synced by default.
+	Datasets []string `json:"datasets"`
+	// CredentialsFile is a service account key file. Application default
+	// credentials are used when it is empty.
+	CredentialsFile string `json:"credentials_file"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+func (b *BigQueryConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		b.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Project == "" {
+		return errors.New("invalid options: project is required")
+	}
+
+	ctx := b.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var clientOptions []option.ClientOption
+	if opts.CredentialsFile != "" {
+		clientOptions = append(clientOptions, option.WithCredentialsFile(opts.CredentialsFile))
+	}
+	client, err := bigquery.NewClient(ctx, opts.Project, clientOptions...)
+	if err != nil {
+		b.logger.Error("Failed to create BigQuery client", "error", err)
+		return fmt.Errorf("failed to create BigQuery client: %w", err)
+	}
+	defer client.Close()
+	b.client = client
+
+	datasets := opts.Datasets
+	if datasets == nil {
+		datasets, err = b.listDatasets(ctx)
+		if err != nil {
+			b.logger.Warn("Failed to list datasets", "error", err)
+			return err
+		}
+	}
+
+	var errs []error
+	for _, dataset := range datasets {
+		err := b.listTables(ctx, opts.Project, dataset, cb)
+		if err != nil {
+			b.logger.Warn("Failed to list tables", "dataset", dataset, "error", err)
+			errs = append(errs, fmt.Errorf("dataset %s: %w", dataset, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (b *BigQueryConnector) listDatasets(ctx context.Context) ([]string, error) {
+	res := []string{}
+	it := b.client.Datasets(ctx)
+	for {
+		ds, err := it.Next()
+		if err == iterator.Done {
+			return res, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, ds.DatasetID)
+	}
+}
+
+func (b *BigQueryConnector) listTables(ctx context.Context, project, dataset string, cb plugin.CallbackHandler) error {
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	it := b.client.Dataset(dataset).Tables(ctx)
+	for {
+		t, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			// Send the tables listed before the error.
+			return errors.Join(err, batch.Flush())
+		}
+		md, err := t.Metadata(ctx)
+		if err != nil {
+			b.logger.Warn("Failed to get table metadata", "dataset", dataset, "table", t.TableID, "error", err)
+			continue
+		}
+		if err := batch.Add(tableObject(project, dataset, t.TableID, md)); err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+func tableObject(project, dataset, table string, md *bigquery.TableMetadata) *proto.DataObject {
+	fields := make([]string, 0, len(md.Schema))
+	for _, f := range md.Schema {
+		fields = append(fields, f.Name)
+	}
+	id := fmt.Sprintf("bq://%s/%s/%s", project, dataset, table)
+	return &proto.DataObject{
+		RemoteId:     id,
+		ResourceName: project + "." + dataset + "." + table,
+		Uri:          id,
+		Metadata: map[string]string{
+			"type":          string(md.Type),
+			"row_count":     strconv.FormatUint(md.NumRows, 10),
+			"size_bytes":    strconv.FormatInt(md.NumBytes, 10),
+			"fields":        strings.Join(fields, ","),
+			"creation_time": md.CreationTime.Format(time.RFC3339),
+			"last_modified": md.LastModifiedTime.Format(time.RFC3339),
+		}}
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &BigQueryConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type ConfluenceConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *http.Client
+	opts   Options
+}
+
+type Options struct {
+	// URL is the base of the REST API, such as
+	// https://example.atlassian.net/wiki for Confluence Cloud or
+	// https://confluence.example.com for Confluence Server and Data
+	// Center.
+	URL string `json:"url"`
+	// Email and Token authenticate to Confluence Cloud with an API token.
+	// Token alone is sent as a Server/Data Center personal access token.
+	// Token defaults to CONFLUENCE_TOKEN.
+	Email string `json:"email"`
+	Token string `json:"token"`
+	// Spaces restricts the catalog to these space keys. Every space the
+	// token can read is synced by default.
+	Spaces         []string `json:"spaces"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+// pageLimit is the number of results requested per API page.
+const pageLimit = 100
+
+type links struct {
+	Base  string `json:"base"`
+	Next  string `json:"next"`
+	WebUI string `json:"webui"`
+}
+
+type space struct {
+	Key string `json:"key"`
+}
+
+type page struct {
+	ID      string `json:"id"`
+	Title   string `json:"title"`
+	Space   space  `json:"space"`
+	Version struct {
+		Number int    `json:"number"`
+		When   string `json:"when"`
+	} `json:"version"`
+	Links links `json:"_links"`
+}
+
+func (c *ConfluenceConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		c.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.URL == "" {
+		return errors.New("invalid options: url is required")
+	}
+	if opts.Token == "" {
+		opts.Token = os.Getenv("CONFLUENCE_TOKEN")
+	}
+	if opts.Token == "" {
+		return errors.New("invalid options: token is required")
+	}
+	opts.URL = strings.TrimSuffix(opts.URL, "/")
+	c.opts = opts
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := 30 * time.Second
+	if opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	}
+	c.client = &http.Client{Timeout: timeout}
+
+	spaces := opts.Spaces
+	if spaces == nil {
+		spaces, err = c.listSpaces(ctx)
+		if err != nil {
+			c.logger.Error("Failed to list spaces", "error", err)
+			return fmt.Errorf("failed to list spaces: %w", err)
+		}
+	}
+
+	var errs []error
+	for _, key := range spaces {
+		if err := c.syncSpace(ctx, key, cb); err != nil {
+			c.logger.Warn("Failed to list pages", "space", key, "error", err)
+			errs = append(errs, fmt.Errorf("space %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// listSpaces returns the keys of every space the token can read.
+func (c *ConfluenceConnector) listSpaces(ctx context.Context) ([]string, error) {
+	var res []string
+	path := "/rest/api/space?limit=" + strconv.Itoa(pageLimit)
+	for path != "" {
+		var resp struct {
+			Results []space `json:"results"`
+			Links   links   `json:"_links"`
+		}
+		if err := c.get(ctx, path, &resp); err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Results {
+			res = append(res, s.Key)
+		}
+		path = resp.Links.Next
+	}
+	return res, nil
+}
+
+// syncSpace sends a DataObject for each current page of a space.
+func (c *ConfluenceConnector) syncSpace(ctx context.Context, key string, cb plugin.CallbackHandler) error {
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+
+	query := url.Values{
+		"spaceKey": {key},
+		"type":     {"page"},
+		"status":   {"current"},
+		"expand":   {"space,version"},
+		"limit":    {strconv.Itoa(pageLimit)},
+	}
+	path := "/rest/api/content?" + query.Encode()
+	for path != "" {
+		var resp struct {
+			Results []page `json:"results"`
+			Links   links  `json:"_links"`
+		}
+		if err := c.get(ctx, path, &resp); err != nil {
+			return errors.Join(err, batch.Flush())
+		}
+		for _, p := range resp.Results {
+			if err := batch.Add(c.dataObject(p, resp.Links.Base)); err != nil {
+				return err
+			}
+		}
+		path = resp.Links.Next
+	}
+	return batch.Flush()
+}
+
+// dataObject converts a page. The RemoteId is the page ID link, which
+// survives renames, and the Uri is the page's web UI link on base.
+func (c *ConfluenceConnector) dataObject(p page, base string) *proto.DataObject {
+	if base == "" {
+		base = c.opts.URL
+	}
+	lastModified := p.Version.When
+	if t, err := time.Parse(time.RFC3339, lastModified); err == nil {
+		lastModified = t.UTC().Format(time.RFC3339)
+	}
+	id := c.opts.URL + "/pages/viewpage.action?pageId=" + url.QueryEscape(p.ID)
+	uri := id
+	if p.Links.WebUI != "" {
+		uri = base + p.Links.WebUI
+	}
+	return &proto.DataObject{
+		RemoteId:     id,
+		ResourceName: p.Title,
+		Uri:          uri,
+		Metadata: map[string]string{
+			"id":            p.ID,
+			"space_key":     p.Space.Key,
+			"version":       strconv.Itoa(p.Version.Number),
+			"last_modified": lastModified,
+		}}
+}
+
+// get decodes the JSON response to GET path into v. Path is relative to the
+// API base, as are the next links of paginated responses.
+func (c *ConfluenceConnector) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.opts.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.opts.Email != "" {
+		req.SetBasicAuth(c.opts.Email, c.opts.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &ConfluenceConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
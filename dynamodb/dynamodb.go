@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/awsconfig"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type DynamoDBConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *dynamodb.Client
+}
+
+type Options struct {
+	// Credentials holds the profile, region and credential options shared
+	// with the S3 connector.
+	awsconfig.Credentials
+	// Tables restricts the catalog to these tables. Every table of the
+	// region is synced by default.
+	Tables []string `json:"tables"`
+}
+
+func (d *DynamoDBConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		d.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+
+	ctx := d.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	cfg, err := awsconfig.Load(ctx, opts.Credentials)
+	if err != nil {
+		d.logger.Error("Failed to load AWS config", "error", err)
+		return fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	d.client = dynamodb.NewFromConfig(cfg)
+
+	tables := opts.Tables
+	if tables == nil {
+		tables, err = d.listTables(ctx)
+		if err != nil {
+			d.logger.Warn("Failed to list tables", "error", err)
+			return err
+		}
+	}
+
+	var errs []error
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	for _, table := range tables {
+		obj, err := d.describeTable(ctx, table)
+		if err != nil {
+			d.logger.Warn("Failed to describe table", "table", table, "error", err)
+			errs = append(errs, fmt.Errorf("table %s: %w", table, err))
+			continue
+		}
+		// The batch is only sent by Flush, so Add cannot fail.
+		_ = batch.Add(obj)
+	}
+	if err := batch.Flush(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+func (d *DynamoDBConnector) listTables(ctx context.Context) ([]string, error) {
+	res := []string{}
+	p := dynamodb.NewListTablesPaginator(d.client, &dynamodb.ListTablesInput{})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, page.TableNames...)
+	}
+	return res, nil
+}
+
+func (d *DynamoDBConnector) describeTable(ctx context.Context, table string) (*proto.DataObject, error) {
+	out, err := d.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &table})
+	if err != nil {
+		return nil, err
+	}
+	t := out.Table
+
+	keySchema := make([]string, 0, len(t.KeySchema))
+	for _, key := range t.KeySchema {
+		keySchema = append(keySchema, aws.ToString(key.AttributeName)+":"+string(key.KeyType))
+	}
+	creationDate := ""
+	if t.CreationDateTime != nil {
+		creationDate = t.CreationDateTime.Format(time.RFC3339)
+	}
+
+	arn := aws.ToString(t.TableArn)
+	return &proto.DataObject{
+		RemoteId:     arn,
+		ResourceName: aws.ToString(t.TableName),
+		Uri:          arn,
+		Metadata: map[string]string{
+			"key_schema":    strings.Join(keySchema, ","),
+			"item_count":    strconv.FormatInt(aws.ToInt64(t.ItemCount), 10),
+			"size_bytes":    strconv.FormatInt(aws.ToInt64(t.TableSizeBytes), 10),
+			"status":        string(t.TableStatus),
+			"creation_date": creationDate,
+		}}, nil
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &DynamoDBConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
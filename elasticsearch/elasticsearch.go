@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type ElasticsearchConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *http.Client
+	opts   Options
+}
+
+type Options struct {
+	// URL is the cluster endpoint, such as https://localhost:9200. Both
+	// Elasticsearch and OpenSearch are supported.
+	URL string `json:"url"`
+	// Cluster names the cluster in RemoteIds, the cluster_name reported
+	// by the cluster by default.
+	Cluster string `json:"cluster"`
+	// Username and Password use basic authentication. APIKey, the
+	// base64-encoded id:key pair, takes precedence over them.
+	Username string `json:"username"`
+	Password string `json:"password"`
+	APIKey   string `json:"api_key"`
+	// CAFile adds a PEM CA bundle to the system roots.
+	CAFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// IndexPattern restricts the catalog to matching indices, such as
+	// "logs-*". Hidden indices, starting with ".", are skipped unless
+	// IncludeHidden is set.
+	IndexPattern   string `json:"index_pattern"`
+	IncludeHidden  bool   `json:"include_hidden"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+type catIndex struct {
+	Index     string `json:"index"`
+	Health    string `json:"health"`
+	Status    string `json:"status"`
+	DocsCount string `json:"docs.count"`
+	StoreSize string `json:"store.size"`
+}
+
+type indexMapping struct {
+	Mappings struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	} `json:"mappings"`
+}
+
+func (e *ElasticsearchConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		e.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.URL == "" {
+		return errors.New("invalid options: url is required")
+	}
+	if opts.IndexPattern == "" {
+		opts.IndexPattern = "*"
+	}
+	e.opts = opts
+
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	e.client, err = newClient(opts)
+	if err != nil {
+		e.logger.Error("Failed to configure HTTP client", "error", err)
+		return fmt.Errorf("failed to configure HTTP client: %w", err)
+	}
+
+	cluster := opts.Cluster
+	if cluster == "" {
+		var info struct {
+			ClusterName string `json:"cluster_name"`
+		}
+		if err := e.get(ctx, "/", &info); err != nil {
+			return fmt.Errorf("failed to get cluster info: %w", err)
+		}
+		cluster = info.ClusterName
+	}
+
+	pattern := url.PathEscape(opts.IndexPattern)
+	catPath := "/_cat/indices/" + pattern + "?format=json&bytes=b&h=index,health,status,docs.count,store.size"
+	mappingPath := "/" + pattern + "/_mapping"
+	if opts.IncludeHidden {
+		// Wildcards only match hidden indices with expand_wildcards.
+		catPath += "&expand_wildcards=all"
+		mappingPath += "?expand_wildcards=all"
+	}
+	var indices []catIndex
+	if err := e.get(ctx, catPath, &indices); err != nil {
+		return fmt.Errorf("failed to list indices: %w", err)
+	}
+	var mappings map[string]indexMapping
+	if err := e.get(ctx, mappingPath, &mappings); err != nil {
+		return fmt.Errorf("failed to get mappings: %w", err)
+	}
+
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	for _, index := range indices {
+		if strings.HasPrefix(index.Index, ".") && !opts.IncludeHidden {
+			continue
+		}
+		fields := make([]string, 0, len(mappings[index.Index].Mappings.Properties))
+		for field := range mappings[index.Index].Mappings.Properties {
+			fields = append(fields, field)
+		}
+		slices.Sort(fields)
+
+		id := fmt.Sprintf("es://%s/%s", cluster, index.Index)
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     id,
+			ResourceName: index.Index,
+			Uri:          id,
+			Metadata: map[string]string{
+				"docs_count":       index.DocsCount,
+				"store_size_bytes": index.StoreSize,
+				"health":           index.Health,
+				"status":           index.Status,
+				"fields":           strings.Join(fields, ","),
+			}})
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+// get decodes the JSON response to GET path into v.
+func (e *ElasticsearchConnector) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(e.opts.URL, "/")+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	switch {
+	case e.opts.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+e.opts.APIKey)
+	case e.opts.Username != "":
+		req.SetBasicAuth(e.opts.Username, e.opts.Password)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func newClient(opts Options) (*http.Client, error) {
+	config, err := pluginserve.TLSConfig(opts.CAFile, opts.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+
+	timeout := 30 * time.Second
+	if opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &ElasticsearchConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-plugins/internal/plugintest"
+)
+
+func TestSyncIncludeHidden(t *testing.T) {
+	for _, includeHidden := range []bool{false, true} {
+		var queries []string
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/_cat/indices/*":
+				queries = append(queries, r.URL.Query().Get("expand_wildcards"))
+				w.Write([]byte(`[{"index": "logs"}, {"index": ".security"}]`))
+			case "/*/_mapping":
+				queries = append(queries, r.URL.Query().Get("expand_wildcards"))
+				w.Write([]byte(`{}`))
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+
+		options, _ := json.Marshal(Options{URL: srv.URL, Cluster: "test", IncludeHidden: includeHidden})
+		rec := &plugintest.Recorder{}
+		err := (&ElasticsearchConnector{logger: hclog.NewNullLogger()}).Sync(string(options), rec)
+		srv.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want, objects := "", 1
+		if includeHidden {
+			want, objects = "all", 2
+		}
+		if len(queries) != 2 || queries[0] != want || queries[1] != want {
+			t.Errorf("include_hidden %v: expand_wildcards = %q, want %q on both requests", includeHidden, queries, want)
+		}
+		if got := len(rec.Objects()); got != objects {
+			t.Errorf("include_hidden %v: got %d indices, want %d", includeHidden, got, objects)
+		}
+	}
+}
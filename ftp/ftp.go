@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/jlaffaye/ftp"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type FTPConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+}
+
+type Options struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// User and Password log in to the server. User defaults to
+	// anonymous.
+	User     string `json:"user"`
+	Password string `json:"password"`
+	// Root is the remote directory listed, "/" by default. Recursive also
+	// walks its subdirectories.
+	Root      string `json:"root"`
+	Recursive bool   `json:"recursive"`
+	// Data connections are always passive. DisableEPSV sends PASV instead
+	// of EPSV, for servers or firewalls that only handle the former.
+	DisableEPSV bool `json:"disable_epsv"`
+	// TLS upgrades the control and data connections with AUTH TLS
+	// (explicit FTPS). CAFile adds a PEM CA bundle to the system roots.
+	TLS                bool   `json:"tls"`
+	CAFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+func (f *FTPConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		f.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Host == "" {
+		return errors.New("invalid options: host is required")
+	}
+	if opts.Port == 0 {
+		opts.Port = 21
+	}
+	if opts.User == "" {
+		opts.User = "anonymous"
+	}
+	if opts.Root == "" {
+		opts.Root = "/"
+	}
+
+	ctx := f.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	dialOptions, err := dialOptions(ctx, opts)
+	if err != nil {
+		f.logger.Error("Failed to configure FTP client", "error", err)
+		return fmt.Errorf("failed to configure FTP client: %w", err)
+	}
+	addr := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+	conn, err := ftp.Dial(addr, dialOptions...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Quit()
+
+	if err := conn.Login(opts.User, opts.Password); err != nil {
+		return fmt.Errorf("failed to log in as %s: %w", opts.User, err)
+	}
+
+	return f.walk(ctx, conn, addr, opts, cb)
+}
+
+// dialOptions returns the connection options for the passive mode and TLS
+// options.
+func dialOptions(ctx context.Context, opts Options) ([]ftp.DialOption, error) {
+	dialOptions := []ftp.DialOption{
+		ftp.DialWithContext(ctx),
+		ftp.DialWithTimeout(30 * time.Second),
+		ftp.DialWithDisabledEPSV(opts.DisableEPSV),
+	}
+	if !opts.TLS {
+		if opts.CAFile != "" || opts.InsecureSkipVerify {
+			return nil, errors.New("ca_file and insecure_skip_verify require tls")
+		}
+		return dialOptions, nil
+	}
+	config, err := pluginserve.TLSConfig(opts.CAFile, opts.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	config.ServerName = opts.Host
+	return append(dialOptions, ftp.DialWithExplicitTLS(config)), nil
+}
+
+func (f *FTPConnector) walk(ctx context.Context, conn *ftp.ServerConn, addr string, opts Options, cb plugin.CallbackHandler) error {
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+
+	w := conn.Walk(opts.Root)
+	for w.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entry := w.Stat()
+		if entry.Type == ftp.EntryTypeFolder && !opts.Recursive {
+			w.SkipDir()
+		}
+		if entry.Type != ftp.EntryTypeFile {
+			continue
+		}
+
+		uri := (&url.URL{Scheme: "ftp", Host: addr, Path: w.Path()}).String()
+		metadata := map[string]string{
+			"size":     strconv.FormatUint(entry.Size, 10),
+			"mod_time": "",
+		}
+		if !entry.Time.IsZero() {
+			metadata["mod_time"] = entry.Time.Format(time.RFC3339)
+		}
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     uri,
+			ResourceName: w.Path(),
+			Uri:          uri,
+			Metadata:     metadata})
+		if err != nil {
+			return err
+		}
+	}
+	// The walk stops at the first directory that cannot be listed.
+	if err := w.Err(); err != nil {
+		return errors.Join(fmt.Errorf("failed to list %s: %w", w.Path(), err), batch.Flush())
+	}
+	return batch.Flush()
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &FTPConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+type GCSConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *storage.Client
+}
+
+type Options struct {
+	// Project is used to list buckets when Buckets is not set.
+	Project string   `json:"project"`
+	MaxKeys int      `json:"max_keys"`
+	Buckets []string `json:"buckets"`
+	Prefix  string   `json:"prefix"`
+	// CredentialsFile is a service account key file. Application default
+	// credentials are used when it is empty.
+	CredentialsFile string `json:"credentials_file"`
+}
+
+// defaultPageSize is the number of objects requested per page when MaxKeys
+// is not set.
+const defaultPageSize = 1000
+
+func (g *GCSConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		g.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Buckets == nil && opts.Project == "" {
+		return errors.New("invalid options: project is required when buckets is not set")
+	}
+
+	ctx := g.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var clientOptions []option.ClientOption
+	if opts.CredentialsFile != "" {
+		clientOptions = append(clientOptions, option.WithCredentialsFile(opts.CredentialsFile))
+	}
+	client, err := storage.NewClient(ctx, clientOptions...)
+	if err != nil {
+		g.logger.Error("Failed to create GCS client", "error", err)
+		return fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	defer client.Close()
+	g.client = client
+
+	buckets := opts.Buckets
+	if buckets == nil {
+		buckets, err = g.listBuckets(ctx, opts.Project)
+		if err != nil {
+			g.logger.Warn("Failed to list buckets", "error", err)
+			return err
+		}
+	}
+
+	var errs []error
+	for _, bucket := range buckets {
+		if err := g.listObjects(ctx, bucket, opts, cb); err != nil {
+			g.logger.Warn("Failed to sync bucket", "bucket", bucket, "error", err)
+			errs = append(errs, fmt.Errorf("bucket %s: %w", bucket, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *GCSConnector) listBuckets(ctx context.Context, project string) ([]string, error) {
+	res := []string{}
+	it := g.client.Buckets(ctx, project)
+	for {
+		bucket, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, bucket.Name)
+	}
+	return res, nil
+}
+
+func (g *GCSConnector) listObjects(ctx context.Context, bucket string, opts Options, cb plugin.CallbackHandler) error {
+	pageSize := opts.MaxKeys
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	it := g.client.Bucket(bucket).Objects(ctx, &storage.Query{Prefix: opts.Prefix})
+	p := iterator.NewPager(it, pageSize, "")
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	var i int
+	for {
+		i++
+		var page []*storage.ObjectAttrs
+		token, err := p.NextPage(&page)
+		if err != nil {
+			return fmt.Errorf("failed to get page %v: %w", i, err)
+		}
+
+		batch.Grow(len(page))
+		for _, obj := range page {
+			uri := fmt.Sprintf("gs://%s/%s", bucket, obj.Name)
+			lastModified := ""
+			if !obj.Updated.IsZero() {
+				lastModified = obj.Updated.Format(time.RFC3339)
+			}
+
+			err := batch.Add(&proto.DataObject{
+				RemoteId:     uri,
+				ResourceName: obj.Name,
+				Uri:          uri,
+				Metadata: map[string]string{
+					"last_modified": lastModified,
+					"size":          strconv.FormatInt(obj.Size, 10),
+				}})
+			if err != nil {
+				return err
+			}
+		}
+		if err := batch.EndPage(); err != nil {
+			return err
+		}
+
+		if token == "" {
+			return nil
+		}
+	}
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &GCSConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+)
+
+type GDriveConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *drive.Service
+}
+
+type Options struct {
+	// CredentialsFile is a service account key file. Application default
+	// credentials are used when it is empty.
+	CredentialsFile string `json:"credentials_file"`
+	// Subject is the user impersonated through domain-wide delegation.
+	// It requires CredentialsFile.
+	Subject string `json:"subject"`
+	// FolderIDs are the folders walked, recursively. The root of the
+	// authenticated user's My Drive is walked by default.
+	FolderIDs []string `json:"folder_ids"`
+	// MimeTypes restricts synced files to these MIME types.
+	MimeTypes []string `json:"mime_types"`
+}
+
+const folderMimeType = "application/vnd.google-apps.folder"
+
+const fileFields = "nextPageToken, files(id, name, mimeType, size, modifiedTime, webViewLink)"
+
+func (g *GDriveConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		g.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Subject != "" && opts.CredentialsFile == "" {
+		return errors.New("invalid options: subject requires credentials_file")
+	}
+	if len(opts.FolderIDs) == 0 {
+		opts.FolderIDs = []string{"root"}
+	}
+
+	ctx := g.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	clientOptions, err := clientOptions(ctx, opts)
+	if err != nil {
+		g.logger.Error("Failed to load credentials", "error", err)
+		return fmt.Errorf("failed to load credentials: %w", err)
+	}
+	g.client, err = drive.NewService(ctx, clientOptions...)
+	if err != nil {
+		g.logger.Error("Failed to create Drive client", "error", err)
+		return fmt.Errorf("failed to create Drive client: %w", err)
+	}
+
+	visited := map[string]bool{}
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	var errs []error
+	for _, folder := range opts.FolderIDs {
+		err := g.walk(ctx, folder, opts, batch, visited)
+		if err != nil {
+			g.logger.Warn("Failed to list folder", "folder", folder, "error", err)
+			errs = append(errs, fmt.Errorf("folder %s: %w", folder, err))
+		}
+		if batch.Err() != nil {
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func clientOptions(ctx context.Context, opts Options) ([]option.ClientOption, error) {
+	if opts.CredentialsFile == "" {
+		return []option.ClientOption{option.WithScopes(drive.DriveReadonlyScope)}, nil
+	}
+	if opts.Subject == "" {
+		return []option.ClientOption{
+			option.WithCredentialsFile(opts.CredentialsFile),
+			option.WithScopes(drive.DriveReadonlyScope),
+		}, nil
+	}
+	data, err := os.ReadFile(opts.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	config, err := google.JWTConfigFromJSON(data, drive.DriveReadonlyScope)
+	if err != nil {
+		return nil, err
+	}
+	config.Subject = opts.Subject
+	return []option.ClientOption{option.WithTokenSource(config.TokenSource(ctx))}, nil
+}
+
+// walk sends the files under folder, one callback per page, and descends
+// into subfolders. visited guards against files with several parents. A
+// subfolder that cannot be listed is skipped and its error returned once
+// the rest of the tree is walked; a failed callback stops the walk.
+func (g *GDriveConnector) walk(ctx context.Context, folder string, opts Options, batch *pluginserve.Batcher, visited map[string]bool) error {
+	if visited[folder] {
+		return nil
+	}
+	visited[folder] = true
+
+	var subfolders []string
+	call := g.client.Files.List().
+		Q(fmt.Sprintf("'%s' in parents and trashed = false", queryEscape(folder))).
+		Fields(fileFields).
+		PageSize(1000).
+		SupportsAllDrives(true).
+		IncludeItemsFromAllDrives(true)
+	err := call.Pages(ctx, func(page *drive.FileList) error {
+		batch.Grow(len(page.Files))
+		for _, f := range page.Files {
+			if f.MimeType == folderMimeType {
+				subfolders = append(subfolders, f.Id)
+				continue
+			}
+			if len(opts.MimeTypes) > 0 && !slices.Contains(opts.MimeTypes, f.MimeType) {
+				continue
+			}
+			err := batch.Add(&proto.DataObject{
+				RemoteId:     f.Id,
+				ResourceName: f.Name,
+				Uri:          f.WebViewLink,
+				Metadata: map[string]string{
+					"mime_type":     f.MimeType,
+					"size":          strconv.FormatInt(f.Size, 10),
+					"modified_time": f.ModifiedTime,
+					"folder_id":     folder,
+				}})
+			if err != nil {
+				return err
+			}
+		}
+		return batch.EndPage()
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range subfolders {
+		err := g.walk(ctx, sub, opts, batch, visited)
+		if err == nil {
+			continue
+		}
+		if batch.Err() != nil || ctx.Err() != nil {
+			return err
+		}
+		errs = append(errs, fmt.Errorf("folder %s: %w", sub, err))
+	}
+	return errors.Join(errs...)
+}
+
+// queryEscape escapes s for a string literal of a Drive search query.
+func queryEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s)
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &GDriveConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/go-github/v69/github"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type GitHubConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *github.Client
+}
+
+type Options struct {
+	// Token is a personal access token, GITHUB_TOKEN by default.
+	Token string `json:"token"`
+	// Orgs restricts the sync to the listed organizations. Every
+	// organization the token's user belongs to is synced when it is empty.
+	Orgs []string `json:"orgs"`
+	// BaseURL points the connector at a GitHub Enterprise Server API, such
+	// as https://github.example.com/api/v3/.
+	BaseURL string `json:"base_url"`
+}
+
+func (g *GitHubConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		g.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Token == "" {
+		opts.Token = os.Getenv("GITHUB_TOKEN")
+	}
+	if opts.Token == "" {
+		return errors.New("invalid options: token is required")
+	}
+
+	ctx := g.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	g.client = github.NewClient(nil).WithAuthToken(opts.Token)
+	if opts.BaseURL != "" {
+		g.client, err = g.client.WithEnterpriseURLs(opts.BaseURL, opts.BaseURL)
+		if err != nil {
+			return fmt.Errorf("invalid options: base_url: %w", err)
+		}
+	}
+
+	orgs := opts.Orgs
+	if len(orgs) == 0 {
+		orgs, err = g.listOrgs(ctx)
+		if err != nil {
+			g.logger.Error("Failed to list organizations", "error", err)
+			return fmt.Errorf("failed to list organizations: %w", err)
+		}
+	}
+
+	var errs []error
+	for _, org := range orgs {
+		err := g.listRepos(ctx, org, cb)
+		if err != nil {
+			g.logger.Error("Failed to list repositories", "org", org, "error", err)
+			errs = append(errs, fmt.Errorf("org %s: %w", org, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *GitHubConnector) listOrgs(ctx context.Context) ([]string, error) {
+	var orgs []string
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := g.client.Organizations.List(ctx, "", opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range page {
+			orgs = append(orgs, o.GetLogin())
+		}
+		if resp.NextPage == 0 {
+			return orgs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func (g *GitHubConnector) listRepos(ctx context.Context, org string, cb plugin.CallbackHandler) error {
+	opts := &github.RepositoryListByOrgOptions{
+		Type:        "all",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	for {
+		repos, resp, err := g.client.Repositories.ListByOrg(ctx, org, opts)
+		if err != nil {
+			return err
+		}
+
+		batch.Grow(len(repos))
+		for _, r := range repos {
+			if err := batch.Add(repoObject(r)); err != nil {
+				return err
+			}
+		}
+		if err := batch.EndPage(); err != nil {
+			return err
+		}
+
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func repoObject(r *github.Repository) *proto.DataObject {
+	visibility := r.GetVisibility()
+	if visibility == "" {
+		visibility = "public"
+		if r.GetPrivate() {
+			visibility = "private"
+		}
+	}
+	var pushedAt string
+	if r.PushedAt != nil {
+		pushedAt = r.GetPushedAt().Format(time.RFC3339)
+	}
+	return &proto.DataObject{
+		RemoteId:     r.GetHTMLURL(),
+		ResourceName: r.GetFullName(),
+		Uri:          r.GetHTMLURL(),
+		Metadata: map[string]string{
+			"default_branch": r.GetDefaultBranch(),
+			"visibility":     visibility,
+			"language":       r.GetLanguage(),
+			"pushed_at":      pushedAt,
+			"archived":       strconv.FormatBool(r.GetArchived()),
+		},
+	}
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &GitHubConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
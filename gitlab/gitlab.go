@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	gitlab "gitlab.com/gitlab-org/api/client-go"
+)
+
+type GitLabConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *gitlab.Client
+}
+
+type Options struct {
+	// Token is a personal, group or project access token, GITLAB_TOKEN by
+	// default.
+	Token string `json:"token"`
+	// Groups are the IDs or full paths of the groups whose projects are
+	// synced.
+	Groups []string `json:"groups"`
+	// IncludeSubgroups also syncs the projects of the groups' subgroups.
+	IncludeSubgroups bool `json:"include_subgroups"`
+	// BaseURL points the connector at a self-hosted GitLab, such as
+	// https://gitlab.example.com. It defaults to gitlab.com.
+	BaseURL string `json:"base_url"`
+}
+
+func (g *GitLabConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		g.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Token == "" {
+		opts.Token = os.Getenv("GITLAB_TOKEN")
+	}
+	if opts.Token == "" {
+		return errors.New("invalid options: token is required")
+	}
+	if len(opts.Groups) == 0 {
+		return errors.New("invalid options: groups is required")
+	}
+
+	ctx := g.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var clientOptions []gitlab.ClientOptionFunc
+	if opts.BaseURL != "" {
+		clientOptions = append(clientOptions, gitlab.WithBaseURL(opts.BaseURL))
+	}
+	g.client, err = gitlab.NewClient(opts.Token, clientOptions...)
+	if err != nil {
+		return fmt.Errorf("invalid options: base_url: %w", err)
+	}
+
+	var errs []error
+	for _, group := range opts.Groups {
+		err := g.listProjects(ctx, group, opts.IncludeSubgroups, cb)
+		if err != nil {
+			g.logger.Error("Failed to list projects", "group", group, "error", err)
+			errs = append(errs, fmt.Errorf("group %s: %w", group, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (g *GitLabConnector) listProjects(ctx context.Context, group string, subgroups bool, cb plugin.CallbackHandler) error {
+	opts := &gitlab.ListGroupProjectsOptions{
+		ListOptions:      gitlab.ListOptions{PerPage: 100},
+		IncludeSubGroups: gitlab.Ptr(subgroups),
+	}
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	for {
+		projects, resp, err := g.client.Groups.ListGroupProjects(group, opts, gitlab.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+
+		batch.Grow(len(projects))
+		for _, p := range projects {
+			if err := batch.Add(projectObject(p)); err != nil {
+				return err
+			}
+		}
+		if err := batch.EndPage(); err != nil {
+			return err
+		}
+
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func projectObject(p *gitlab.Project) *proto.DataObject {
+	var lastActivityAt string
+	if p.LastActivityAt != nil {
+		lastActivityAt = p.LastActivityAt.Format(time.RFC3339)
+	}
+	return &proto.DataObject{
+		RemoteId:     p.WebURL,
+		ResourceName: p.PathWithNamespace,
+		Uri:          p.WebURL,
+		Metadata: map[string]string{
+			"default_branch":   p.DefaultBranch,
+			"visibility":       string(p.Visibility),
+			"last_activity_at": lastActivityAt,
+			"archived":         strconv.FormatBool(p.Archived),
+		},
+	}
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &GitLabConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
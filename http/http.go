@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type HTTPConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *http.Client
+}
+
+// Options describe the API to page through. Field options are dot-separated
+// paths into the JSON documents, such as "data.items" or "$.owner.login";
+// numeric segments index arrays.
+type Options struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	// TimeoutSeconds bounds each request, 30 seconds by default.
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// ItemsField locates the array of items in each response. The response
+	// itself must be an array when it is empty.
+	ItemsField string `json:"items_field"`
+	// NextField locates the URL of the next page in each response. The
+	// rel="next" Link header is used when it is empty.
+	NextField string `json:"next_field"`
+	// MaxPages stops the sync after that many pages. Zero means no limit.
+	MaxPages int `json:"max_pages"`
+	// RemoteIDField, ResourceNameField and URIField locate the DataObject
+	// fields in each item. MetadataFields maps metadata keys to item
+	// fields.
+	RemoteIDField     string            `json:"remote_id_field"`
+	ResourceNameField string            `json:"resource_name_field"`
+	URIField          string            `json:"uri_field"`
+	MetadataFields    map[string]string `json:"metadata_fields"`
+}
+
+func (h *HTTPConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		h.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.URL == "" || opts.RemoteIDField == "" {
+		return errors.New("invalid options: url and remote_id_field are required")
+	}
+
+	ctx := h.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := 30 * time.Second
+	if opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	}
+	h.client = &http.Client{Timeout: timeout}
+
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	// visited holds the page URLs fetched so far, so that a server
+	// pointing back to a page it already served cannot loop the sync.
+	visited := map[string]bool{}
+	next := opts.URL
+	for i := 1; next != ""; i++ {
+		if opts.MaxPages > 0 && i > opts.MaxPages {
+			h.logger.Info("Reached max_pages", "max_pages", opts.MaxPages)
+			break
+		}
+		if visited[next] {
+			return fmt.Errorf("page %v links back to %s, which was already fetched", i-1, next)
+		}
+		visited[next] = true
+
+		var items []interface{}
+		items, next, err = h.getPage(ctx, next, opts)
+		if err != nil {
+			return fmt.Errorf("failed to get page %v: %w", i, err)
+		}
+
+		batch.Grow(len(items))
+		for _, item := range items {
+			remoteID, ok := lookup(item, opts.RemoteIDField)
+			if !ok {
+				h.logger.Warn("Skipping item without remote id", "field", opts.RemoteIDField)
+				continue
+			}
+			metadata := make(map[string]string, len(opts.MetadataFields))
+			for key, field := range opts.MetadataFields {
+				if v, ok := lookup(item, field); ok {
+					metadata[key] = stringify(v)
+				}
+			}
+			obj := &proto.DataObject{
+				RemoteId: stringify(remoteID),
+				Metadata: metadata,
+			}
+			if v, ok := lookup(item, opts.ResourceNameField); ok && opts.ResourceNameField != "" {
+				obj.ResourceName = stringify(v)
+			}
+			if v, ok := lookup(item, opts.URIField); ok && opts.URIField != "" {
+				obj.Uri = stringify(v)
+			}
+			if err := batch.Add(obj); err != nil {
+				return err
+			}
+		}
+		if err := batch.EndPage(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPage fetches pageURL and returns its items and the absolute URL of the
+// next page, empty on the last page.
+func (h *HTTPConnector) getPage(ctx context.Context, pageURL string, opts Options) ([]interface{}, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	for k, v := range opts.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, "", fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var doc interface{}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	v, ok := lookup(doc, opts.ItemsField)
+	if !ok {
+		return nil, "", fmt.Errorf("items field %q not found", opts.ItemsField)
+	}
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("items field %q is not an array", opts.ItemsField)
+	}
+
+	var next string
+	if opts.NextField != "" {
+		if v, ok := lookup(doc, opts.NextField); ok && v != nil {
+			next = stringify(v)
+		}
+	} else {
+		next = nextLink(resp.Header.Values("Link"))
+	}
+	if next == "" {
+		return items, "", nil
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, "", err
+	}
+	ref, err := url.Parse(next)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid next page URL %q: %w", next, err)
+	}
+	return items, base.ResolveReference(ref).String(), nil
+}
+
+// lookup returns the value at the dot-separated field path of v. An empty
+// path or "$" returns v itself.
+func lookup(v interface{}, field string) (interface{}, bool) {
+	field = strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+	if field == "" {
+		return v, true
+	}
+	for _, segment := range strings.Split(field, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			var ok bool
+			if v, ok = node[segment]; !ok {
+				return nil, false
+			}
+		case []interface{}:
+			i, err := strconv.Atoi(segment)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil, false
+			}
+			v = node[i]
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// stringify formats a decoded JSON value as a metadata string. Objects and
+// arrays are re-encoded as JSON.
+func stringify(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// nextLink returns the rel="next" target of RFC 8288 Link header values.
+func nextLink(values []string) string {
+	for _, value := range values {
+		for _, link := range strings.Split(value, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				name, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				rels := strings.Fields(strings.Trim(val, `"`))
+				if strings.EqualFold(name, "rel") && slices.ContainsFunc(rels, isNext) {
+					return target[1 : len(target)-1]
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func isNext(rel string) bool {
+	return strings.EqualFold(rel, "next")
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &HTTPConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,156 @@
+// Package awsconfig loads the AWS configuration of the AWS connector
+// plugins from their common credential options.
+package awsconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// Credentials are the region and credential options shared by the AWS
+// connectors. They are embedded in each connector's options.
+type Credentials struct {
+	Profile string `json:"profile"`
+	// Region defaults to AWS_REGION, AWS_DEFAULT_REGION and then the
+	// profile's region.
+	Region string `json:"region"`
+	// RoleARN, when set, is assumed on top of the loaded credentials,
+	// typically to read resources in another account.
+	RoleARN         string `json:"role_arn"`
+	ExternalID      string `json:"external_id"`
+	RoleSessionName string `json:"role_session_name"`
+	// AccessKeyID and SecretAccessKey, when both set, replace the shared
+	// profile credentials.
+	AccessKeyID     string `json:"access_key_id"`
+	SecretAccessKey string `json:"secret_access_key"`
+	SessionToken    string `json:"session_token"`
+	// CredentialSource selects where credentials come from:
+	//
+	//   - profile (default): the SDK default chain with Profile, which
+	//     covers static, process and SSO profiles.
+	//   - sso: Profile, which must be configured for IAM Identity Center.
+	//     Run "aws sso login" first.
+	//   - web_identity: the token file and role of AWS_WEB_IDENTITY_TOKEN_FILE
+	//     and AWS_ROLE_ARN, as set up by EKS IAM roles for service accounts.
+	//   - env: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+	//   - instance: the EC2 instance profile, through IMDS.
+	CredentialSource string `json:"credential_source"`
+}
+
+// Credential sources accepted in Credentials.CredentialSource.
+const (
+	SourceProfile     = "profile"
+	SourceSSO         = "sso"
+	SourceWebIdentity = "web_identity"
+	SourceEnv         = "env"
+	SourceInstance    = "instance"
+)
+
+// Load loads the default AWS configuration for c. optFns are applied after
+// the options derived from c.
+func Load(ctx context.Context, c Credentials, optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	region := c.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	loadOptions := []func(*config.LoadOptions) error{
+		config.WithRegion(region),
+	}
+	source := c.CredentialSource
+	if source == "" {
+		source = SourceProfile
+	}
+	if c.AccessKeyID != "" && source != SourceProfile {
+		return aws.Config{}, fmt.Errorf("access_key_id cannot be used with credential_source %q", source)
+	}
+
+	switch source {
+	case SourceProfile:
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(c.Profile))
+		if c.AccessKeyID != "" && c.SecretAccessKey != "" {
+			loadOptions = append(loadOptions, config.WithCredentialsProvider(
+				credentials.NewStaticCredentialsProvider(c.AccessKeyID, c.SecretAccessKey, c.SessionToken),
+			))
+		}
+	case SourceSSO:
+		profile := c.Profile
+		if profile == "" {
+			profile = config.DefaultSharedConfigProfile
+		}
+		// Unlike LoadDefaultConfig, LoadSharedConfigProfile does not read
+		// the file locations from the environment.
+		shared, err := config.LoadSharedConfigProfile(ctx, profile, func(o *config.LoadSharedConfigOptions) {
+			if file := os.Getenv("AWS_CONFIG_FILE"); file != "" {
+				o.ConfigFiles = []string{file}
+			}
+			if file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); file != "" {
+				o.CredentialsFiles = []string{file}
+			}
+		})
+		if err != nil {
+			return aws.Config{}, err
+		}
+		if shared.SSOSessionName == "" && shared.SSOStartURL == "" {
+			return aws.Config{}, fmt.Errorf("profile %q has no SSO configuration", profile)
+		}
+		loadOptions = append(loadOptions, config.WithSharedConfigProfile(profile))
+	case SourceWebIdentity:
+		tokenFile, roleARN := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN")
+		if tokenFile == "" || roleARN == "" {
+			return aws.Config{}, errors.New("web_identity requires AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN")
+		}
+		// AssumeRoleWithWebIdentity is unsigned, so the STS client needs no
+		// credentials of its own.
+		stsCfg, err := config.LoadDefaultConfig(ctx, append(loadOptions, config.WithCredentialsProvider(aws.AnonymousCredentials{}))...)
+		if err != nil {
+			return aws.Config{}, err
+		}
+		provider := stscreds.NewWebIdentityRoleProvider(sts.NewFromConfig(stsCfg), roleARN, stscreds.IdentityTokenFile(tokenFile))
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(aws.NewCredentialsCache(provider)))
+	case SourceEnv:
+		id, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY")
+		if id == "" || secret == "" {
+			return aws.Config{}, errors.New("env requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(id, secret, os.Getenv("AWS_SESSION_TOKEN")),
+		))
+	case SourceInstance:
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(aws.NewCredentialsCache(ec2rolecreds.New())))
+	default:
+		return aws.Config{}, fmt.Errorf("unknown credential_source %q", c.CredentialSource)
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, append(loadOptions, optFns...)...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+	if cfg.Region == "" {
+		return aws.Config{}, errors.New("no AWS region found: set the region option, AWS_REGION or AWS_DEFAULT_REGION, or a region in the profile")
+	}
+
+	if c.RoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), c.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+			if c.ExternalID != "" {
+				o.ExternalID = aws.String(c.ExternalID)
+			}
+			if c.RoleSessionName != "" {
+				o.RoleSessionName = c.RoleSessionName
+			}
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
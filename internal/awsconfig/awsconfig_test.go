@@ -0,0 +1,108 @@
+package awsconfig
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config")
+	err := os.WriteFile(configFile, []byte("[profile plain]\nregion = eu-west-1\n\n[profile sso]\nregion = eu-west-1\nsso_session = corp\n\n[sso-session corp]\nsso_start_url = https://example.awsapps.com/start\nsso_region = eu-west-1\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		creds   Credentials
+		env     map[string]string
+		wantErr string
+		// wantKey is the access key ID of the loaded credentials.
+		wantKey string
+	}{
+		{
+			name:    "unknown source",
+			creds:   Credentials{Region: "us-east-1", CredentialSource: "vault"},
+			wantErr: `unknown credential_source "vault"`,
+		},
+		{
+			name:    "access key with another source",
+			creds:   Credentials{Region: "us-east-1", CredentialSource: SourceEnv, AccessKeyID: "AKIA", SecretAccessKey: "secret"},
+			wantErr: `access_key_id cannot be used with credential_source "env"`,
+		},
+		{
+			name:    "env without variables",
+			creds:   Credentials{Region: "us-east-1", CredentialSource: SourceEnv},
+			env:     map[string]string{"AWS_ACCESS_KEY_ID": "AKIA"},
+			wantErr: "env requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY",
+		},
+		{
+			name:    "env",
+			creds:   Credentials{Region: "us-east-1", CredentialSource: SourceEnv},
+			env:     map[string]string{"AWS_ACCESS_KEY_ID": "AKIAENV", "AWS_SECRET_ACCESS_KEY": "secret"},
+			wantKey: "AKIAENV",
+		},
+		{
+			name:    "web identity without variables",
+			creds:   Credentials{Region: "us-east-1", CredentialSource: SourceWebIdentity},
+			env:     map[string]string{"AWS_WEB_IDENTITY_TOKEN_FILE": filepath.Join(dir, "token")},
+			wantErr: "web_identity requires AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN",
+		},
+		{
+			name:    "sso profile without sso configuration",
+			creds:   Credentials{Profile: "plain", CredentialSource: SourceSSO},
+			wantErr: `profile "plain" has no SSO configuration`,
+		},
+		{
+			name:  "sso profile",
+			creds: Credentials{Profile: "sso", CredentialSource: SourceSSO},
+		},
+		{
+			name:    "static keys",
+			creds:   Credentials{Region: "us-east-1", AccessKeyID: "AKIASTATIC", SecretAccessKey: "secret"},
+			wantKey: "AKIASTATIC",
+		},
+		{
+			name:    "no region",
+			creds:   Credentials{AccessKeyID: "AKIASTATIC", SecretAccessKey: "secret"},
+			wantErr: "no AWS region found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{
+				"AWS_REGION", "AWS_DEFAULT_REGION", "AWS_PROFILE",
+				"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+				"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN",
+			} {
+				t.Setenv(key, tt.env[key])
+			}
+			t.Setenv("AWS_CONFIG_FILE", configFile)
+			t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+
+			cfg, err := Load(context.Background(), tt.creds)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Load() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if tt.wantKey != "" {
+				creds, err := cfg.Credentials.Retrieve(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				if creds.AccessKeyID != tt.wantKey {
+					t.Errorf("access key ID = %q, want %q", creds.AccessKeyID, tt.wantKey)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package pluginserve
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+)
+
+// Batcher buffers DataObjects and sends them to a callback every Size
+// objects, or at every EndPage when Size is not positive. A send that still
+// fails after Retries is kept: it is returned by every later call and
+// nothing more is sent, so connectors stop at the first lost batch.
+type Batcher struct {
+	// Size is the number of objects per callback.
+	Size int
+	// Retries is how many times a failed callback is retried, with
+	// exponential backoff. Zero sends each batch once.
+	Retries int
+
+	ctx context.Context
+	cb  plugin.CallbackHandler
+	res []*proto.DataObject
+	err error
+}
+
+// Backoff between callback retries, doubled after each attempt.
+const (
+	callbackBackoff    = 100 * time.Millisecond
+	callbackMaxBackoff = 5 * time.Second
+)
+
+// NewBatcher returns a Batcher sending batches of size objects to cb. ctx
+// interrupts the backoff between retries.
+func NewBatcher(ctx context.Context, cb plugin.CallbackHandler, size int) *Batcher {
+	return &Batcher{Size: size, ctx: ctx, cb: cb}
+}
+
+// Add buffers obj and sends the batch once it holds Size objects.
+func (b *Batcher) Add(obj *proto.DataObject) error {
+	if b.err != nil {
+		return b.err
+	}
+	if b.res == nil && b.Size > 0 {
+		b.res = make([]*proto.DataObject, 0, b.Size)
+	}
+	b.res = append(b.res, obj)
+	if b.Size > 0 && len(b.res) >= b.Size {
+		return b.Flush()
+	}
+	return nil
+}
+
+// Grow makes room for n more objects when batches are per page.
+func (b *Batcher) Grow(n int) {
+	if b.Size <= 0 {
+		b.res = slices.Grow(b.res, n)
+	}
+}
+
+// EndPage sends the batch when batches are per page.
+func (b *Batcher) EndPage() error {
+	if b.Size <= 0 {
+		return b.Flush()
+	}
+	return b.err
+}
+
+// Flush sends the buffered objects, if any.
+func (b *Batcher) Flush() error {
+	if len(b.res) == 0 || b.err != nil {
+		return b.err
+	}
+	backoff := callbackBackoff
+	for attempt := 0; ; attempt++ {
+		_, err := b.cb.Callback(&proto.SyncResponse{Response: b.res})
+		if err == nil {
+			break
+		}
+		if attempt == b.Retries {
+			b.err = fmt.Errorf("failed to send objects: %w", err)
+			if attempt > 0 {
+				b.err = fmt.Errorf("failed to send objects after %d attempts: %w", attempt+1, err)
+			}
+			return b.err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-b.ctx.Done():
+			b.err = fmt.Errorf("failed to send objects: %w", err)
+			return b.err
+		}
+		backoff = min(2*backoff, callbackMaxBackoff)
+	}
+	b.res = nil
+	return nil
+}
+
+// Err returns the error of the failed send, if any.
+func (b *Batcher) Err() error {
+	return b.err
+}
+
+// Len returns the number of objects waiting to be sent.
+func (b *Batcher) Len() int {
+	return len(b.res)
+}
@@ -0,0 +1,82 @@
+package pluginserve
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/plugintest"
+)
+
+func TestBatcher(t *testing.T) {
+	rec := &plugintest.Recorder{}
+	b := NewBatcher(context.Background(), rec, 2)
+	for range 5 {
+		if err := b.Add(&proto.DataObject{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, res := range rec.Responses() {
+		sizes = append(sizes, len(res.Response))
+	}
+	if len(sizes) != 3 || sizes[0] != 2 || sizes[1] != 2 || sizes[2] != 1 {
+		t.Errorf("batch sizes = %v, want [2 2 1]", sizes)
+	}
+}
+
+func TestBatcherPerPage(t *testing.T) {
+	rec := &plugintest.Recorder{}
+	b := NewBatcher(context.Background(), rec, 0)
+	for range 3 {
+		b.Add(&proto.DataObject{})
+	}
+	if rec.Calls() != 0 || b.Len() != 3 {
+		t.Fatalf("sent %d batches with %d pending before EndPage", rec.Calls(), b.Len())
+	}
+	if err := b.EndPage(); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Calls() != 1 || b.Len() != 0 {
+		t.Errorf("sent %d batches with %d pending after EndPage, want 1 and 0", rec.Calls(), b.Len())
+	}
+}
+
+func TestBatcherError(t *testing.T) {
+	errHost := errors.New("host unavailable")
+	tests := []struct {
+		name    string
+		retries int
+		failing int
+		calls   int
+		wantErr bool
+	}{
+		{name: "no retries", retries: 0, failing: 1, calls: 1, wantErr: true},
+		{name: "retried", retries: 2, failing: 2, calls: 4},
+		{name: "retries exhausted", retries: 2, failing: 10, calls: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := &plugintest.Recorder{Err: plugintest.FailFirst(tt.failing, errHost)}
+			b := NewBatcher(context.Background(), rec, 1)
+			b.Retries = tt.retries
+
+			err := b.Add(&proto.DataObject{})
+			if tt.wantErr != (err != nil) || (err != nil && !errors.Is(err, errHost)) {
+				t.Fatalf("Add() error = %v, want error %v", err, tt.wantErr)
+			}
+			// A failed send stops the batcher.
+			err2 := b.Add(&proto.DataObject{})
+			if tt.wantErr && (err2 != err || b.Flush() != err || b.Err() != err) {
+				t.Errorf("later calls returned %v, want %v", err2, err)
+			}
+			if got := rec.Calls(); got != tt.calls {
+				t.Errorf("got %d callbacks, want %d", got, tt.calls)
+			}
+		})
+	}
+}
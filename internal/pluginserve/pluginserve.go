@@ -0,0 +1,96 @@
+// Package pluginserve holds the process setup shared by the connector
+// plugins: logging, signal handling and serving the connector over
+// go-plugin.
+package pluginserve
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/hashicorp/go-hclog"
+	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/pidanou/c1-core/pkg/plugin"
+)
+
+// HandshakeConfig is the handshake expected by the c1 host.
+var HandshakeConfig = goplugin.HandshakeConfig{
+	ProtocolVersion:  1,
+	MagicCookieKey:   "BASIC_PLUGIN",
+	MagicCookieValue: "hello",
+}
+
+// Handshake returns HandshakeConfig with the values overridden by the
+// C1_PLUGIN_COOKIE_KEY, C1_PLUGIN_COOKIE_VALUE and C1_PLUGIN_PROTOCOL_VERSION
+// environment variables when set.
+func Handshake(logger hclog.Logger) goplugin.HandshakeConfig {
+	hs := HandshakeConfig
+	if v := os.Getenv("C1_PLUGIN_COOKIE_KEY"); v != "" {
+		hs.MagicCookieKey = v
+	}
+	if v := os.Getenv("C1_PLUGIN_COOKIE_VALUE"); v != "" {
+		hs.MagicCookieValue = v
+	}
+	if v := os.Getenv("C1_PLUGIN_PROTOCOL_VERSION"); v != "" {
+		version, err := strconv.ParseUint(v, 10, 0)
+		if err != nil {
+			logger.Warn("Invalid C1_PLUGIN_PROTOCOL_VERSION, using default", "value", v, "error", err)
+		} else {
+			hs.ProtocolVersion = uint(version)
+		}
+	}
+	return hs
+}
+
+// NewLogger returns the JSON stderr logger read by the host. The level is
+// taken from C1_PLUGIN_LOG_LEVEL and defaults to Info.
+func NewLogger() hclog.Logger {
+	level := hclog.LevelFromString(os.Getenv("C1_PLUGIN_LOG_LEVEL"))
+	if level == hclog.NoLevel {
+		level = hclog.Info
+	}
+	return hclog.New(&hclog.LoggerOptions{
+		Level:      level,
+		Output:     os.Stderr,
+		JSONFormat: true,
+	})
+}
+
+// SignalContext returns a context cancelled when the process receives
+// SIGINT or SIGTERM.
+func SignalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+}
+
+// Serve serves connector to the host and blocks until the host disconnects.
+func Serve(logger hclog.Logger, connector plugin.Connector) {
+	var pluginMap = map[string]goplugin.Plugin{
+		"connector": &plugin.ConnectorGRPCPlugin{Impl: connector},
+	}
+
+	goplugin.Serve(&goplugin.ServeConfig{
+		HandshakeConfig: Handshake(logger),
+		Plugins:         pluginMap,
+		GRPCServer:      goplugin.DefaultGRPCServer,
+	})
+}
+
+// DecodeOptions decodes the JSON options passed to Sync into v. Options
+// starting with "@" name a file holding the JSON instead, as in curl, which
+// keeps large configurations out of the host's arguments and logs.
+func DecodeOptions(options string, v interface{}) error {
+	data := []byte(options)
+	if path, ok := strings.CutPrefix(options, "@"); ok {
+		var err error
+		data, err = os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("options file: %w", err)
+		}
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,50 @@
+package pluginserve
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTLSConfig(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	emptyFile := filepath.Join(dir, "empty.pem")
+	if err := os.WriteFile(emptyFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := TLSConfig(emptyFile, false); err == nil || !strings.Contains(err.Error(), "no certificates found") {
+		t.Errorf("TLSConfig(%s) error = %v, want no certificates found", emptyFile, err)
+	}
+	if _, err := TLSConfig(filepath.Join(dir, "missing.pem"), false); err == nil {
+		t.Error("TLSConfig() with a missing file succeeded")
+	}
+
+	config, err := TLSConfig("", true)
+	if err != nil || !config.InsecureSkipVerify || config.RootCAs != nil {
+		t.Errorf("TLSConfig(\"\", true) = %+v, %v, want insecure with the system pool", config, err)
+	}
+
+	config, err = TLSConfig(caFile, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with ca_file failed: %v", err)
+	}
+	resp.Body.Close()
+}
@@ -0,0 +1,41 @@
+package pluginserve
+
+import (
+	"context"
+	"os"
+
+	"github.com/hashicorp/go-hclog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Tracing installs an OTLP/HTTP trace exporter as the global tracer
+// provider when OTEL_EXPORTER_OTLP_ENDPOINT or
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set. The exporter reads the other
+// standard OTEL_EXPORTER_OTLP_* variables. Otherwise the global no-op
+// provider is left in place. The returned function flushes pending spans.
+func Tracing(ctx context.Context, logger hclog.Logger, service string) func() {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func() {}
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		logger.Error("Failed to create trace exporter", "error", err)
+		return func() {}
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(service))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func() {
+		if err := provider.Shutdown(context.Background()); err != nil {
+			logger.Error("Failed to flush traces", "error", err)
+		}
+	}
+}
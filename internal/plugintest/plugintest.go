@@ -0,0 +1,70 @@
+// Package plugintest provides a fake plugin.CallbackHandler for exercising
+// connectors without a host.
+package plugintest
+
+import (
+	"sync"
+
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+)
+
+// Recorder is a plugin.CallbackHandler that records every response it
+// receives. It is safe for concurrent use.
+type Recorder struct {
+	// Err, when set, is called with the 1-based number of each callback.
+	// A non-nil result is returned to the connector and the response is
+	// not recorded.
+	Err func(call int) error
+
+	mu        sync.Mutex
+	calls     int
+	responses []*proto.SyncResponse
+}
+
+func (r *Recorder) Callback(res *proto.SyncResponse) (*proto.Empty, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.Err != nil {
+		if err := r.Err(r.calls); err != nil {
+			return &proto.Empty{}, err
+		}
+	}
+	r.responses = append(r.responses, res)
+	return &proto.Empty{}, nil
+}
+
+// Calls returns the number of callbacks made, failed ones included.
+func (r *Recorder) Calls() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls
+}
+
+// Responses returns the recorded responses in the order received.
+func (r *Recorder) Responses() []*proto.SyncResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*proto.SyncResponse(nil), r.responses...)
+}
+
+// Objects returns the DataObjects of all recorded responses, in order.
+func (r *Recorder) Objects() []*proto.DataObject {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var objects []*proto.DataObject
+	for _, res := range r.responses {
+		objects = append(objects, res.Response...)
+	}
+	return objects
+}
+
+// FailFirst returns an Err function failing the first n callbacks with err.
+func FailFirst(n int, err error) func(int) error {
+	return func(call int) error {
+		if call <= n {
+			return err
+		}
+		return nil
+	}
+}
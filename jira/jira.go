@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type JiraConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *http.Client
+	opts   Options
+}
+
+type Options struct {
+	// URL is the site, such as https://example.atlassian.net for Jira
+	// Cloud or https://jira.example.com for Jira Server and Data Center.
+	URL string `json:"url"`
+	// Email and Token authenticate to Jira Cloud with an API token. Token
+	// alone is sent as a Server/Data Center personal access token. Token
+	// defaults to JIRA_TOKEN.
+	Email string `json:"email"`
+	Token string `json:"token"`
+	// Cloud selects the Jira Cloud API. It defaults to true for
+	// atlassian.net sites.
+	Cloud *bool `json:"cloud"`
+	// Projects restricts the catalog to these project keys.
+	Projects       []string `json:"projects"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+// jiraTime is the timestamp layout of the Jira REST API.
+const jiraTime = "2006-01-02T15:04:05.000-0700"
+
+type project struct {
+	Key         string `json:"key"`
+	Name        string `json:"name"`
+	ProjectType string `json:"projectTypeKey"`
+	Lead        struct {
+		DisplayName string `json:"displayName"`
+	} `json:"lead"`
+	// Insight is only returned by Jira Cloud.
+	Insight *struct {
+		TotalIssueCount     int64  `json:"totalIssueCount"`
+		LastIssueUpdateTime string `json:"lastIssueUpdateTime"`
+	} `json:"insight"`
+}
+
+func (j *JiraConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		j.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.URL == "" {
+		return errors.New("invalid options: url is required")
+	}
+	if opts.Token == "" {
+		opts.Token = os.Getenv("JIRA_TOKEN")
+	}
+	if opts.Token == "" {
+		return errors.New("invalid options: token is required")
+	}
+	opts.URL = strings.TrimSuffix(opts.URL, "/")
+	if opts.Cloud == nil {
+		u, err := url.Parse(opts.URL)
+		if err != nil {
+			return fmt.Errorf("invalid options: url: %w", err)
+		}
+		cloud := strings.HasSuffix(u.Hostname(), ".atlassian.net")
+		opts.Cloud = &cloud
+	}
+	j.opts = opts
+
+	ctx := j.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	timeout := 30 * time.Second
+	if opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	}
+	j.client = &http.Client{Timeout: timeout}
+
+	var projects []project
+	if *opts.Cloud {
+		projects, err = j.searchProjects(ctx)
+	} else {
+		err = j.get(ctx, "/rest/api/2/project?expand=lead", &projects)
+	}
+	if err != nil {
+		j.logger.Error("Failed to list projects", "error", err)
+		return fmt.Errorf("failed to list projects: %w", err)
+	}
+	if opts.Projects != nil {
+		projects = slices.DeleteFunc(projects, func(p project) bool {
+			return !slices.Contains(opts.Projects, p.Key)
+		})
+	}
+
+	var errs []error
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	for _, p := range projects {
+		count, updated := "", ""
+		if p.Insight != nil {
+			count = strconv.FormatInt(p.Insight.TotalIssueCount, 10)
+			updated = p.Insight.LastIssueUpdateTime
+		} else {
+			count, updated, err = j.issueStats(ctx, p.Key)
+			if err != nil {
+				j.logger.Warn("Failed to count issues", "project", p.Key, "error", err)
+				errs = append(errs, fmt.Errorf("project %s: %w", p.Key, err))
+			}
+		}
+		if t, err := time.Parse(jiraTime, updated); err == nil {
+			updated = t.UTC().Format(time.RFC3339)
+		}
+
+		uri := opts.URL + "/browse/" + url.PathEscape(p.Key)
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     uri,
+			ResourceName: p.Key,
+			Uri:          uri,
+			Metadata: map[string]string{
+				"name":         p.Name,
+				"project_type": p.ProjectType,
+				"lead":         p.Lead.DisplayName,
+				"issue_count":  count,
+				"last_updated": updated,
+			}})
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+	if err := batch.Flush(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// searchProjects pages through the Jira Cloud project search, which returns
+// the lead and issue insight of every project.
+func (j *JiraConnector) searchProjects(ctx context.Context) ([]project, error) {
+	var res []project
+	startAt := 0
+	for {
+		var page struct {
+			Values []project `json:"values"`
+			IsLast bool      `json:"isLast"`
+		}
+		path := "/rest/api/3/project/search?expand=lead,insight&maxResults=100&startAt=" + strconv.Itoa(startAt)
+		if err := j.get(ctx, path, &page); err != nil {
+			return nil, err
+		}
+		res = append(res, page.Values...)
+		if page.IsLast || len(page.Values) == 0 {
+			return res, nil
+		}
+		startAt += len(page.Values)
+	}
+}
+
+// issueStats returns the issue count and the last issue update time of a
+// project, for Jira Server which has no project insight.
+func (j *JiraConnector) issueStats(ctx context.Context, key string) (count, updated string, err error) {
+	var page struct {
+		Total  int64 `json:"total"`
+		Issues []struct {
+			Fields struct {
+				Updated string `json:"updated"`
+			} `json:"fields"`
+		} `json:"issues"`
+	}
+	jql := url.QueryEscape(fmt.Sprintf("project = %q ORDER BY updated DESC", key))
+	if err := j.get(ctx, "/rest/api/2/search?fields=updated&maxResults=1&jql="+jql, &page); err != nil {
+		return "", "", err
+	}
+	if len(page.Issues) > 0 {
+		updated = page.Issues[0].Fields.Updated
+	}
+	return strconv.FormatInt(page.Total, 10), updated, nil
+}
+
+// get decodes the JSON response to GET path into v.
+func (j *JiraConnector) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.opts.URL+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if j.opts.Email != "" {
+		req.SetBasicAuth(j.opts.Email, j.opts.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+j.opts.Token)
+	}
+
+	resp, err := j.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &JiraConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
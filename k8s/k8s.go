@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	metadataclient "k8s.io/client-go/metadata"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+type K8sConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client metadataclient.Interface
+}
+
+type Options struct {
+	// Kubeconfig is the kubeconfig file, KUBECONFIG or ~/.kube/config by
+	// default. The in-cluster config is used when no kubeconfig is found
+	// or InCluster is set.
+	Kubeconfig string `json:"kubeconfig"`
+	Context    string `json:"context"`
+	InCluster  bool   `json:"in_cluster"`
+	// Kinds lists the resource kinds synced, as Kind or Kind.group, such
+	// as "Deployment.apps" or "Secret". It defaults to DefaultKinds. Only
+	// object metadata is read, so Secret values are never fetched.
+	Kinds []string `json:"kinds"`
+	// Namespaces restricts namespaced kinds to these namespaces. Every
+	// namespace is synced by default.
+	Namespaces []string `json:"namespaces"`
+}
+
+// DefaultKinds are the kinds synced when Options.Kinds is empty.
+var DefaultKinds = []string{"Deployment.apps", "StatefulSet.apps", "DaemonSet.apps", "PersistentVolumeClaim"}
+
+// pageSize is the number of objects requested per list call and sent per
+// callback.
+const pageSize = 500
+
+func (k *K8sConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		k.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if len(opts.Kinds) == 0 {
+		opts.Kinds = DefaultKinds
+	}
+	if len(opts.Namespaces) == 0 {
+		opts.Namespaces = []string{metav1.NamespaceAll}
+	}
+
+	ctx := k.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	config, err := restConfig(opts)
+	if err != nil {
+		k.logger.Error("Failed to load Kubernetes config", "error", err)
+		return fmt.Errorf("failed to load Kubernetes config: %w", err)
+	}
+	k.client, err = metadataclient.NewForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	host := strings.TrimSuffix(config.Host, "/")
+
+	var errs []error
+	for _, kind := range opts.Kinds {
+		mapping, err := mapper.RESTMapping(schema.ParseGroupKind(kind))
+		if err != nil {
+			k.logger.Warn("Unknown kind", "kind", kind, "error", err)
+			errs = append(errs, fmt.Errorf("kind %s: %w", kind, err))
+			continue
+		}
+		namespaces := opts.Namespaces
+		if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			namespaces = []string{metav1.NamespaceAll}
+		}
+		for _, ns := range namespaces {
+			if err := k.listObjects(ctx, host, mapping, ns, cb); err != nil {
+				k.logger.Warn("Failed to list objects", "kind", kind, "namespace", ns, "error", err)
+				errs = append(errs, fmt.Errorf("kind %s: %w", kind, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// restConfig returns the in-cluster config or the kubeconfig one.
+func restConfig(opts Options) (*rest.Config, error) {
+	if opts.InCluster {
+		return rest.InClusterConfig()
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = opts.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: opts.Context}
+	// Falls back to the in-cluster config when no kubeconfig is found.
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+}
+
+func (k *K8sConnector) listObjects(ctx context.Context, host string, mapping *meta.RESTMapping, namespace string, cb plugin.CallbackHandler) error {
+	gvk := mapping.GroupVersionKind
+	resource := k.client.Resource(mapping.Resource)
+	listOptions := metav1.ListOptions{Limit: pageSize}
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	for {
+		var list *metav1.PartialObjectMetadataList
+		var err error
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			list, err = resource.Namespace(namespace).List(ctx, listOptions)
+		} else {
+			list, err = resource.List(ctx, listOptions)
+		}
+		if err != nil {
+			return err
+		}
+
+		batch.Grow(len(list.Items))
+		for _, obj := range list.Items {
+			name := obj.Name
+			if obj.Namespace != "" {
+				name = obj.Namespace + "/" + obj.Name
+			}
+			metadata := map[string]string{
+				"kind":               gvk.Kind,
+				"api_version":        gvk.GroupVersion().String(),
+				"namespace":          obj.Namespace,
+				"creation_timestamp": obj.CreationTimestamp.UTC().Format(time.RFC3339),
+			}
+			for key, value := range obj.Labels {
+				metadata["label:"+key] = value
+			}
+			err := batch.Add(&proto.DataObject{
+				RemoteId:     string(obj.UID),
+				ResourceName: name,
+				Uri:          host + objectPath(mapping, obj.Namespace, obj.Name),
+				Metadata:     metadata})
+			if err != nil {
+				return err
+			}
+		}
+		if err := batch.EndPage(); err != nil {
+			return err
+		}
+
+		if list.Continue == "" {
+			return nil
+		}
+		listOptions.Continue = list.Continue
+	}
+}
+
+// objectPath returns the API path of an object, what its selfLink used to
+// hold.
+func objectPath(mapping *meta.RESTMapping, namespace, name string) string {
+	gvr := mapping.Resource
+	path := "/api/" + gvr.Version
+	if gvr.Group != "" {
+		path = "/apis/" + gvr.Group + "/" + gvr.Version
+	}
+	if namespace != "" {
+		path += "/namespaces/" + namespace
+	}
+	return path + "/" + gvr.Resource + "/" + name
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &K8sConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
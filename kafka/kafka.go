@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+)
+
+type KafkaConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *kafka.Client
+}
+
+type Options struct {
+	Brokers []string `json:"brokers"`
+	// Cluster names the cluster in RemoteIds, the cluster id reported by
+	// the brokers by default.
+	Cluster string `json:"cluster"`
+	// Topics restricts the sync to the listed topics. Internal topics are
+	// skipped unless IncludeInternal is set.
+	Topics          []string `json:"topics"`
+	IncludeInternal bool     `json:"include_internal"`
+	// TLS enables TLS to the brokers. CAFile adds a PEM CA bundle to the
+	// system roots.
+	TLS                bool   `json:"tls"`
+	CAFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	// SASLMechanism is one of plain, scram-sha-256 or scram-sha-512.
+	SASLMechanism  string `json:"sasl_mechanism"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	TimeoutSeconds int    `json:"timeout_seconds"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+// dynamicTopicConfig is the DescribeConfigs source of per-topic overrides.
+const dynamicTopicConfig = 1
+
+func (k *KafkaConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		k.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if len(opts.Brokers) == 0 {
+		return errors.New("invalid options: brokers is required")
+	}
+
+	ctx := k.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	transport, err := newTransport(opts)
+	if err != nil {
+		k.logger.Error("Failed to configure Kafka client", "error", err)
+		return fmt.Errorf("failed to configure Kafka client: %w", err)
+	}
+	timeout := 30 * time.Second
+	if opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(opts.TimeoutSeconds) * time.Second
+	}
+	k.client = &kafka.Client{
+		Addr:      kafka.TCP(opts.Brokers...),
+		Timeout:   timeout,
+		Transport: transport,
+	}
+
+	metadata, err := k.client.Metadata(ctx, &kafka.MetadataRequest{Topics: opts.Topics})
+	if err != nil {
+		k.logger.Error("Failed to get cluster metadata", "error", err)
+		return fmt.Errorf("failed to get cluster metadata: %w", err)
+	}
+	cluster := opts.Cluster
+	if cluster == "" {
+		cluster = metadata.ClusterID
+	}
+
+	var errs []error
+	topics := slices.DeleteFunc(metadata.Topics, func(t kafka.Topic) bool {
+		if t.Error != nil {
+			k.logger.Error("Failed to describe topic", "topic", t.Name, "error", t.Error)
+			errs = append(errs, fmt.Errorf("topic %s: %w", t.Name, t.Error))
+			return true
+		}
+		return t.Internal && !opts.IncludeInternal
+	})
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	for chunk := range slices.Chunk(topics, batchSize) {
+		res, err := k.describeTopics(ctx, cluster, chunk)
+		if err != nil {
+			k.logger.Error("Failed to describe topic configs", "error", err)
+			return fmt.Errorf("failed to describe topic configs: %w", err)
+		}
+		for _, obj := range res {
+			if err := batch.Add(obj); err != nil {
+				return err
+			}
+		}
+	}
+	if err := batch.Flush(); err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
+
+// describeTopics returns a DataObject per topic with its partition layout
+// and config overrides.
+func (k *KafkaConnector) describeTopics(ctx context.Context, cluster string, topics []kafka.Topic) ([]*proto.DataObject, error) {
+	req := &kafka.DescribeConfigsRequest{}
+	for _, t := range topics {
+		req.Resources = append(req.Resources, kafka.DescribeConfigRequestResource{
+			ResourceType: kafka.ResourceTypeTopic,
+			ResourceName: t.Name,
+		})
+	}
+	resp, err := k.client.DescribeConfigs(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	configs := make(map[string][]kafka.DescribeConfigResponseConfigEntry, len(resp.Resources))
+	for _, r := range resp.Resources {
+		if r.Error != nil {
+			k.logger.Warn("Failed to describe topic config", "topic", r.ResourceName, "error", r.Error)
+			continue
+		}
+		configs[r.ResourceName] = r.ConfigEntries
+	}
+
+	res := make([]*proto.DataObject, 0, len(topics))
+	for _, t := range topics {
+		replicationFactor := 0
+		for _, p := range t.Partitions {
+			replicationFactor = max(replicationFactor, len(p.Replicas))
+		}
+		metadata := map[string]string{
+			"partitions":         strconv.Itoa(len(t.Partitions)),
+			"replication_factor": strconv.Itoa(replicationFactor),
+			"internal":           strconv.FormatBool(t.Internal),
+		}
+		for _, e := range configs[t.Name] {
+			if e.ConfigSource != dynamicTopicConfig || e.IsSensitive {
+				continue
+			}
+			metadata["config:"+e.ConfigName] = e.ConfigValue
+		}
+		res = append(res, &proto.DataObject{
+			RemoteId:     fmt.Sprintf("kafka://%s/%s", cluster, t.Name),
+			ResourceName: t.Name,
+			Metadata:     metadata,
+		})
+	}
+	return res, nil
+}
+
+func newTransport(opts Options) (*kafka.Transport, error) {
+	transport := &kafka.Transport{}
+	if opts.TLS {
+		config, err := pluginserve.TLSConfig(opts.CAFile, opts.InsecureSkipVerify)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLS = config
+	}
+
+	var mechanism sasl.Mechanism
+	var err error
+	switch strings.ToLower(opts.SASLMechanism) {
+	case "":
+	case "plain":
+		mechanism = plain.Mechanism{Username: opts.Username, Password: opts.Password}
+	case "scram-sha-256":
+		mechanism, err = scram.Mechanism(scram.SHA256, opts.Username, opts.Password)
+	case "scram-sha-512":
+		mechanism, err = scram.Mechanism(scram.SHA512, opts.Username, opts.Password)
+	default:
+		return nil, fmt.Errorf("unsupported sasl_mechanism %q", opts.SASLMechanism)
+	}
+	if err != nil {
+		return nil, err
+	}
+	transport.SASL = mechanism
+	return transport, nil
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &KafkaConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
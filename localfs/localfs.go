@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type LocalFSConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+}
+
+type Options struct {
+	Roots     []string `json:"roots"`
+	Recursive bool     `json:"recursive"`
+	// Include and Exclude are path.Match glob patterns applied to the path
+	// of each file relative to its root, with forward slashes. A path
+	// matching any Exclude pattern is dropped even if it also matches an
+	// Include pattern.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// FollowSymlinks syncs the targets of symbolic links. Each directory
+	// is walked at most once, so link cycles are not followed.
+	FollowSymlinks bool `json:"follow_symlinks"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+func (l *LocalFSConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		l.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	for _, pattern := range append(opts.Include, opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	ctx := l.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var errs []error
+	for _, root := range opts.Roots {
+		if err := l.syncRoot(ctx, root, opts, cb); err != nil {
+			l.logger.Warn("Failed to sync root", "root", root, "error", err)
+			errs = append(errs, fmt.Errorf("root %s: %w", root, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (l *LocalFSConnector) syncRoot(ctx context.Context, root string, opts Options, cb plugin.CallbackHandler) error {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	real, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return err
+	}
+
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	emit := func(p, rel string, info fs.FileInfo) error {
+		uri := (&url.URL{Scheme: "file", Path: filepath.ToSlash(p)}).String()
+		return batch.Add(&proto.DataObject{
+			RemoteId:     uri,
+			ResourceName: rel,
+			Uri:          uri,
+			Metadata: map[string]string{
+				"size":     strconv.FormatInt(info.Size(), 10),
+				"mod_time": info.ModTime().Format(time.RFC3339),
+				"mode":     info.Mode().String(),
+			}})
+	}
+
+	if err := l.walk(ctx, root, "", opts, map[string]bool{real: true}, emit); err != nil {
+		return err
+	}
+	return batch.Flush()
+}
+
+// walk lists dir, whose path relative to the root is rel, and calls emit for
+// every regular file matching the patterns. visited holds the resolved path
+// of every directory already walked.
+func (l *LocalFSConnector) walk(ctx context.Context, dir, rel string, opts Options, visited map[string]bool, emit func(p, rel string, info fs.FileInfo) error) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		p := filepath.Join(dir, entry.Name())
+		r := path.Join(rel, entry.Name())
+
+		info, err := entry.Info()
+		if err != nil {
+			l.logger.Warn("Failed to stat file", "path", p, "error", err)
+			continue
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if !opts.FollowSymlinks {
+				continue
+			}
+			info, err = os.Stat(p)
+			if err != nil {
+				l.logger.Warn("Failed to follow symlink", "path", p, "error", err)
+				continue
+			}
+		}
+
+		if info.IsDir() {
+			if !opts.Recursive {
+				continue
+			}
+			real, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				l.logger.Warn("Failed to resolve directory", "path", p, "error", err)
+				continue
+			}
+			if visited[real] {
+				continue
+			}
+			visited[real] = true
+			if err := l.walk(ctx, p, r, opts, visited, emit); err != nil {
+				// Unreadable directories are skipped, while the context
+				// and callback errors stop the walk.
+				var pathErr *fs.PathError
+				if !errors.As(err, &pathErr) {
+					return err
+				}
+				l.logger.Warn("Failed to walk directory", "path", p, "error", err)
+			}
+			continue
+		}
+
+		if !info.Mode().IsRegular() || !matchPatterns(r, opts.Include, opts.Exclude) {
+			continue
+		}
+		if err := emit(p, r, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchPatterns reports whether name matches one of include and none of
+// exclude. An empty include list matches every name. Patterns are expected
+// to have been validated beforehand.
+func matchPatterns(name string, include, exclude []string) bool {
+	for _, pattern := range exclude {
+		if ok, _ := path.Match(pattern, name); ok {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &LocalFSConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-plugins/internal/plugintest"
+)
+
+func TestSync(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"a.txt", "sub/b.txt"} {
+		p := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte("data"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	options, _ := json.Marshal(Options{Roots: []string{root}, Recursive: true})
+	l := &LocalFSConnector{logger: hclog.NewNullLogger()}
+
+	rec := &plugintest.Recorder{}
+	if err := l.Sync(string(options), rec); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, obj := range rec.Objects() {
+		names = append(names, obj.ResourceName)
+	}
+	slices.Sort(names)
+	if want := []string{"a.txt", "sub/b.txt"}; !slices.Equal(names, want) {
+		t.Errorf("synced %q, want %q", names, want)
+	}
+
+	errHost := errors.New("host unavailable")
+	rec = &plugintest.Recorder{Err: plugintest.FailFirst(1, errHost)}
+	if err := l.Sync(string(options), rec); !errors.Is(err, errHost) {
+		t.Errorf("Sync() error = %v, want %v", err, errHost)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"go.mongodb.org/mongo-driver/v2/bson"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+	"go.mongodb.org/mongo-driver/v2/mongo/options"
+)
+
+type MongoDBConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *mongo.Client
+}
+
+type Options struct {
+	// URI is a mongodb:// or mongodb+srv:// connection string.
+	URI string `json:"uri"`
+	// Databases restricts the catalog to these databases. The admin,
+	// config and local databases are always skipped.
+	Databases []string `json:"databases"`
+	// SampleSize, when positive, samples that many documents of each
+	// collection to list its top-level field names.
+	SampleSize int `json:"sample_size"`
+	// TLS enables TLS on top of what the URI sets. CAFile adds a PEM CA
+	// bundle to the system roots.
+	TLS                bool   `json:"tls"`
+	CAFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+var systemDatabases = []string{"admin", "config", "local"}
+
+type collStats struct {
+	StorageStats struct {
+		Count       int64 `bson:"count"`
+		Size        int64 `bson:"size"`
+		StorageSize int64 `bson:"storageSize"`
+	} `bson:"storageStats"`
+}
+
+func (m *MongoDBConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		m.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.URI == "" {
+		return errors.New("invalid options: uri is required")
+	}
+
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	clientOptions, err := clientOptions(opts)
+	if err != nil {
+		m.logger.Error("Failed to configure MongoDB client", "error", err)
+		return fmt.Errorf("failed to configure MongoDB client: %w", err)
+	}
+	client, err := mongo.Connect(clientOptions)
+	if err != nil {
+		m.logger.Error("Failed to connect to MongoDB", "error", err)
+		return fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+	defer client.Disconnect(context.Background())
+	m.client = client
+
+	databases := opts.Databases
+	if databases == nil {
+		databases, err = client.ListDatabaseNames(ctx, bson.D{})
+		if err != nil {
+			m.logger.Warn("Failed to list databases", "error", err)
+			return err
+		}
+	}
+	databases = slices.DeleteFunc(databases, func(db string) bool {
+		return slices.Contains(systemDatabases, db)
+	})
+
+	host := uriHost(opts.URI)
+	var errs []error
+	for _, db := range databases {
+		err := m.listCollections(ctx, host, db, opts, cb)
+		if err != nil {
+			m.logger.Warn("Failed to list collections", "database", db, "error", err)
+			errs = append(errs, fmt.Errorf("database %s: %w", db, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (m *MongoDBConnector) listCollections(ctx context.Context, host, database string, opts Options, cb plugin.CallbackHandler) error {
+	db := m.client.Database(database)
+	specs, err := db.ListCollectionSpecifications(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	batch.Grow(len(specs))
+	for _, spec := range specs {
+		if strings.HasPrefix(spec.Name, "system.") {
+			continue
+		}
+		metadata := map[string]string{
+			"database": database,
+			"type":     spec.Type,
+		}
+		coll := db.Collection(spec.Name)
+		if spec.Type == "collection" {
+			count, err := coll.EstimatedDocumentCount(ctx)
+			if err != nil {
+				m.logger.Warn("Failed to count documents", "database", database, "collection", spec.Name, "error", err)
+			} else {
+				metadata["estimated_document_count"] = strconv.FormatInt(count, 10)
+			}
+			if stats, err := m.collStats(ctx, coll); err != nil {
+				m.logger.Warn("Failed to get collection stats", "database", database, "collection", spec.Name, "error", err)
+			} else {
+				metadata["size_bytes"] = strconv.FormatInt(stats.StorageStats.Size, 10)
+				metadata["storage_size_bytes"] = strconv.FormatInt(stats.StorageStats.StorageSize, 10)
+			}
+		}
+		if opts.SampleSize > 0 {
+			fields, err := sampleFields(ctx, coll, opts.SampleSize)
+			if err != nil {
+				m.logger.Warn("Failed to sample documents", "database", database, "collection", spec.Name, "error", err)
+			} else {
+				metadata["fields"] = strings.Join(fields, ",")
+			}
+		}
+
+		uri := fmt.Sprintf("mongodb://%s/%s/%s", host, database, spec.Name)
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     uri,
+			ResourceName: database + "." + spec.Name,
+			Uri:          uri,
+			Metadata:     metadata})
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+func (m *MongoDBConnector) collStats(ctx context.Context, coll *mongo.Collection) (collStats, error) {
+	var stats collStats
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$collStats", Value: bson.D{{Key: "storageStats", Value: bson.D{}}}}},
+	})
+	if err != nil {
+		return stats, err
+	}
+	defer cursor.Close(ctx)
+	if cursor.Next(ctx) {
+		err = cursor.Decode(&stats)
+	}
+	if err == nil {
+		err = cursor.Err()
+	}
+	return stats, err
+}
+
+// sampleFields returns the sorted top-level field names of up to n random
+// documents of coll.
+func sampleFields(ctx context.Context, coll *mongo.Collection, n int) ([]string, error) {
+	cursor, err := coll.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$sample", Value: bson.D{{Key: "size", Value: n}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	seen := map[string]bool{}
+	for cursor.Next(ctx) {
+		elements, err := cursor.Current.Elements()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range elements {
+			seen[e.Key()] = true
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields, nil
+}
+
+func clientOptions(opts Options) (*options.ClientOptions, error) {
+	clientOptions := options.Client().ApplyURI(opts.URI)
+	if !opts.TLS && opts.CAFile == "" && !opts.InsecureSkipVerify {
+		return clientOptions, nil
+	}
+	config, err := pluginserve.TLSConfig(opts.CAFile, opts.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	return clientOptions.SetTLSConfig(config), nil
+}
+
+// uriHost returns the hosts named in a connection string, without the
+// credentials.
+func uriHost(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return "localhost"
+	}
+	return u.Host
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &MongoDBConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
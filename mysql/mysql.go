@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type MySQLConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+}
+
+type Options struct {
+	// DSN is a go-sql-driver/mysql data source name, such as
+	// user:password@tcp(localhost:3306)/.
+	DSN string `json:"dsn"`
+	// Databases restricts the catalog to these databases. System
+	// databases are always skipped.
+	Databases []string `json:"databases"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+const systemDatabases = `'mysql', 'information_schema', 'performance_schema', 'sys'`
+
+const tablesQuery = `
+SELECT table_schema, table_name, table_type, COALESCE(engine, ''), table_rows
+FROM information_schema.tables
+WHERE table_schema NOT IN (` + systemDatabases + `)%s
+ORDER BY table_schema, table_name`
+
+const columnsQuery = `
+SELECT table_schema, table_name, column_name, column_type
+FROM information_schema.columns
+WHERE table_schema NOT IN (` + systemDatabases + `)%s
+ORDER BY table_schema, table_name, ordinal_position`
+
+func (m *MySQLConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		m.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.DSN == "" {
+		return errors.New("invalid options: dsn is required")
+	}
+	config, err := mysql.ParseDSN(opts.DSN)
+	if err != nil {
+		return fmt.Errorf("invalid options: dsn: %w", err)
+	}
+
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	db, err := sql.Open("mysql", opts.DSN)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	filter, args := databaseFilter(opts.Databases)
+	columns, err := m.listColumns(ctx, db, filter, args)
+	if err != nil {
+		return fmt.Errorf("failed to list columns: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(tablesQuery, filter), args...)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	for rows.Next() {
+		var database, table, tableType, engine string
+		var tableRows sql.NullInt64
+		if err := rows.Scan(&database, &table, &tableType, &engine, &tableRows); err != nil {
+			return fmt.Errorf("failed to read table: %w", err)
+		}
+
+		name := database + "." + table
+		metadata := map[string]string{
+			"database":   database,
+			"table_type": tableType,
+			"engine":     engine,
+		}
+		if tableRows.Valid {
+			// InnoDB only reports an estimate.
+			metadata["row_count"] = strconv.FormatInt(tableRows.Int64, 10)
+		}
+		for _, column := range columns[name] {
+			metadata["column:"+column.name] = column.dataType
+		}
+		uri := fmt.Sprintf("mysql://%s/%s/%s", config.Addr, database, table)
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     uri,
+			ResourceName: name,
+			Uri:          uri,
+			Metadata:     metadata})
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	return batch.Flush()
+}
+
+// databaseFilter returns the SQL condition and arguments restricting the
+// queries to databases, none when it is empty.
+func databaseFilter(databases []string) (string, []interface{}) {
+	if len(databases) == 0 {
+		return "", nil
+	}
+	args := make([]interface{}, len(databases))
+	for i, db := range databases {
+		args[i] = db
+	}
+	return "\n  AND table_schema IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(databases)), ", ") + ")", args
+}
+
+type column struct {
+	name     string
+	dataType string
+}
+
+// listColumns returns the columns of every table, keyed by database.table.
+func (m *MySQLConnector) listColumns(ctx context.Context, db *sql.DB, filter string, args []interface{}) (map[string][]column, error) {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(columnsQuery, filter), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[string][]column{}
+	for rows.Next() {
+		var database, table string
+		var c column
+		if err := rows.Scan(&database, &table, &c.name, &c.dataType); err != nil {
+			return nil, err
+		}
+		res[database+"."+table] = append(res[database+"."+table], c)
+	}
+	return res, rows.Err()
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &MySQLConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/lib/pq"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+)
+
+type PostgresConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+}
+
+type Options struct {
+	// DSN is a lib/pq connection string, either a postgres:// URL or
+	// key=value pairs.
+	DSN string `json:"dsn"`
+	// Schemas restricts the catalog to these schemas. System schemas are
+	// always skipped.
+	Schemas []string `json:"schemas"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+const tablesQuery = `
+SELECT table_schema, table_name, table_type
+FROM information_schema.tables
+WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
+  AND (cardinality($1::text[]) = 0 OR table_schema = ANY($1))
+ORDER BY table_schema, table_name`
+
+const columnsQuery = `
+SELECT table_schema, table_name, column_name, data_type
+FROM information_schema.columns
+WHERE table_schema NOT IN ('pg_catalog', 'information_schema')
+  AND (cardinality($1::text[]) = 0 OR table_schema = ANY($1))
+ORDER BY table_schema, table_name, ordinal_position`
+
+func (p *PostgresConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		p.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.DSN == "" {
+		return errors.New("invalid options: dsn is required")
+	}
+
+	ctx := p.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	db, err := sql.Open("postgres", opts.DSN)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var database string
+	if err := db.QueryRowContext(ctx, "SELECT current_database()").Scan(&database); err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	host := dsnHost(opts.DSN)
+	// A NULL array would filter out every schema.
+	if opts.Schemas == nil {
+		opts.Schemas = []string{}
+	}
+	schemas := pq.Array(opts.Schemas)
+
+	columns, err := p.listColumns(ctx, db, schemas)
+	if err != nil {
+		return fmt.Errorf("failed to list columns: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, tablesQuery, schemas)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	for rows.Next() {
+		var schema, table, tableType string
+		if err := rows.Scan(&schema, &table, &tableType); err != nil {
+			return fmt.Errorf("failed to read table: %w", err)
+		}
+
+		name := schema + "." + table
+		metadata := map[string]string{
+			"schema":     schema,
+			"table_type": tableType,
+		}
+		for _, column := range columns[tableKey{schema, table}] {
+			metadata["column:"+column.name] = column.dataType
+		}
+		uri := fmt.Sprintf("pg://%s/%s/%s/%s", host, database, schema, table)
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     uri,
+			ResourceName: name,
+			Uri:          uri,
+			Metadata:     metadata})
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	return batch.Flush()
+}
+
+type column struct {
+	name     string
+	dataType string
+}
+
+// tableKey identifies a table. Schema and table names can contain dots, so
+// they are not joined into a single string.
+type tableKey struct {
+	schema, table string
+}
+
+// listColumns returns the columns of every table.
+func (p *PostgresConnector) listColumns(ctx context.Context, db *sql.DB, schemas interface{}) (map[tableKey][]column, error) {
+	rows, err := db.QueryContext(ctx, columnsQuery, schemas)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := map[tableKey][]column{}
+	for rows.Next() {
+		var key tableKey
+		var c column
+		if err := rows.Scan(&key.schema, &key.table, &c.name, &c.dataType); err != nil {
+			return nil, err
+		}
+		res[key] = append(res[key], c)
+	}
+	return res, rows.Err()
+}
+
+// dsnHost returns the host named in a URL or key=value DSN, localhost when
+// none is set.
+func dsnHost(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		if u.Host != "" {
+			return u.Host
+		}
+		return "localhost"
+	}
+	for _, field := range strings.Fields(dsn) {
+		if v, ok := strings.CutPrefix(field, "host="); ok {
+			return strings.Trim(v, "'")
+		}
+	}
+	return "localhost"
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &PostgresConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"github.com/redis/go-redis/v9"
+)
+
+type RedisConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+}
+
+type Options struct {
+	// Addr is the host:port of the server, localhost:6379 by default.
+	Addr     string `json:"addr"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// DBs restricts the catalog to these database indexes. Every database
+	// listed by INFO keyspace is synced by default.
+	DBs []int `json:"dbs"`
+	// Match is a SCAN pattern. When set, each database is scanned for the
+	// matching keys, adding matched_keys and memory_bytes to its metadata.
+	Match string `json:"match"`
+	// PerKey emits one DataObject per key, matching Match when set, with
+	// its type, TTL and memory usage, instead of one per database.
+	PerKey bool `json:"per_key"`
+	// ScanCount is the COUNT hint of each SCAN call, 1000 by default.
+	ScanCount int64 `json:"scan_count"`
+	// TLS enables TLS. CAFile adds a PEM CA bundle to the system roots.
+	TLS                bool   `json:"tls"`
+	CAFile             string `json:"ca_file"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+func (r *RedisConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		r.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Addr == "" {
+		opts.Addr = "localhost:6379"
+	}
+	if opts.ScanCount <= 0 {
+		opts.ScanCount = 1000
+	}
+
+	ctx := r.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	clientOptions, err := clientOptions(opts)
+	if err != nil {
+		r.logger.Error("Failed to configure Redis client", "error", err)
+		return fmt.Errorf("failed to configure Redis client: %w", err)
+	}
+	client := redis.NewClient(clientOptions)
+	defer client.Close()
+
+	info, err := client.Info(ctx, "keyspace").Result()
+	if err != nil {
+		r.logger.Error("Failed to connect to Redis", "error", err)
+		return fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	keyspace := parseKeyspace(info)
+
+	dbs := opts.DBs
+	if dbs == nil {
+		for db := range keyspace {
+			dbs = append(dbs, db)
+		}
+		slices.Sort(dbs)
+	}
+
+	var errs []error
+	for _, db := range dbs {
+		o := *clientOptions
+		o.DB = db
+		c := redis.NewClient(&o)
+		if opts.PerKey {
+			err = r.syncKeys(ctx, c, db, opts, cb)
+		} else {
+			err = r.syncDB(ctx, c, db, keyspace[db], opts, cb)
+		}
+		c.Close()
+		if err != nil {
+			r.logger.Warn("Failed to sync database", "db", db, "error", err)
+			errs = append(errs, fmt.Errorf("db %d: %w", db, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// syncDB sends one DataObject for db with its INFO keyspace statistics.
+func (r *RedisConnector) syncDB(ctx context.Context, c *redis.Client, db int, stats map[string]string, opts Options, cb plugin.CallbackHandler) error {
+	metadata := map[string]string{
+		"db":      strconv.Itoa(db),
+		"keys":    stats["keys"],
+		"expires": stats["expires"],
+		"avg_ttl": stats["avg_ttl"],
+	}
+	if metadata["keys"] == "" {
+		// INFO keyspace omits empty databases.
+		metadata["keys"] = "0"
+	}
+	if opts.Match != "" {
+		var matched, memory int64
+		err := scanKeys(ctx, c, opts.Match, opts.ScanCount, func(keys []string) error {
+			matched += int64(len(keys))
+			pipe := c.Pipeline()
+			cmds := make([]*redis.IntCmd, len(keys))
+			for i, key := range keys {
+				cmds[i] = pipe.MemoryUsage(ctx, key)
+			}
+			// Keys deleted since the scan fail with redis.Nil.
+			_, _ = pipe.Exec(ctx)
+			for _, cmd := range cmds {
+				memory += cmd.Val()
+			}
+			return ctx.Err()
+		})
+		if err != nil {
+			return err
+		}
+		metadata["match"] = opts.Match
+		metadata["matched_keys"] = strconv.FormatInt(matched, 10)
+		metadata["memory_bytes"] = strconv.FormatInt(memory, 10)
+	}
+
+	uri := fmt.Sprintf("redis://%s/%d", opts.Addr, db)
+	batch := pluginserve.NewBatcher(ctx, cb, 0)
+	err := batch.Add(&proto.DataObject{
+		RemoteId:     uri,
+		ResourceName: "db" + strconv.Itoa(db),
+		Uri:          uri,
+		Metadata:     metadata,
+	})
+	if err != nil {
+		return err
+	}
+	return batch.Flush()
+}
+
+// syncKeys sends one DataObject per key of db matching opts.Match.
+func (r *RedisConnector) syncKeys(ctx context.Context, c *redis.Client, db int, opts Options, cb plugin.CallbackHandler) error {
+	match := opts.Match
+	if match == "" {
+		match = "*"
+	}
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	err := scanKeys(ctx, c, match, opts.ScanCount, func(keys []string) error {
+		pipe := c.Pipeline()
+		types := make([]*redis.StatusCmd, len(keys))
+		ttls := make([]*redis.DurationCmd, len(keys))
+		memory := make([]*redis.IntCmd, len(keys))
+		for i, key := range keys {
+			types[i] = pipe.Type(ctx, key)
+			ttls[i] = pipe.TTL(ctx, key)
+			memory[i] = pipe.MemoryUsage(ctx, key)
+		}
+		// Keys deleted since the scan fail with redis.Nil.
+		_, _ = pipe.Exec(ctx)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		for i, key := range keys {
+			if types[i].Val() == "none" {
+				continue
+			}
+			// TTL is -1 for keys without expiry.
+			ttl := ""
+			if d := ttls[i].Val(); d > 0 {
+				ttl = strconv.FormatInt(int64(d/time.Second), 10)
+			}
+			uri := fmt.Sprintf("redis://%s/%d/%s", opts.Addr, db, url.PathEscape(key))
+			err := batch.Add(&proto.DataObject{
+				RemoteId:     uri,
+				ResourceName: key,
+				Uri:          uri,
+				Metadata: map[string]string{
+					"db":           strconv.Itoa(db),
+					"type":         types[i].Val(),
+					"ttl_seconds":  ttl,
+					"memory_bytes": strconv.FormatInt(memory[i].Val(), 10),
+				}})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	// The keys scanned before a SCAN error are sent too.
+	if flushErr := batch.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+// scanKeys calls fn with each batch of keys returned by SCAN for match.
+// Duplicates are only dropped within one SCAN reply: a key can still repeat
+// across batches, as SCAN allows, and the host dedups the objects by
+// RemoteId. The matched_keys count can include these repeats.
+func scanKeys(ctx context.Context, c *redis.Client, match string, count int64, fn func(keys []string) error) error {
+	var cursor uint64
+	for {
+		keys, next, err := c.Scan(ctx, cursor, match, count).Result()
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]struct{}, len(keys))
+		keys = slices.DeleteFunc(keys, func(key string) bool {
+			if _, ok := seen[key]; ok {
+				return true
+			}
+			seen[key] = struct{}{}
+			return false
+		})
+		if len(keys) > 0 {
+			if err := fn(keys); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// parseKeyspace parses the INFO keyspace section, whose lines look like
+// "db0:keys=1,expires=0,avg_ttl=0", into the statistics of each database.
+func parseKeyspace(info string) map[int]map[string]string {
+	res := map[int]map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		name, fields, ok := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if !ok || !strings.HasPrefix(name, "db") {
+			continue
+		}
+		db, err := strconv.Atoi(strings.TrimPrefix(name, "db"))
+		if err != nil {
+			continue
+		}
+		stats := map[string]string{}
+		for _, field := range strings.Split(fields, ",") {
+			if k, v, ok := strings.Cut(field, "="); ok {
+				stats[k] = v
+			}
+		}
+		res[db] = stats
+	}
+	return res
+}
+
+func clientOptions(opts Options) (*redis.Options, error) {
+	clientOptions := &redis.Options{
+		Addr:     opts.Addr,
+		Username: opts.Username,
+		Password: opts.Password,
+	}
+	if !opts.TLS && opts.CAFile == "" && !opts.InsecureSkipVerify {
+		return clientOptions, nil
+	}
+	config, err := pluginserve.TLSConfig(opts.CAFile, opts.InsecureSkipVerify)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions.TLSConfig = config
+	return clientOptions, nil
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &RedisConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
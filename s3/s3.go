@@ -1,147 +1,2454 @@
 package main
 
 import (
+	"compress/gzip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"github.com/hashicorp/go-hclog"
-	goplugin "github.com/hashicorp/go-plugin"
+	"github.com/parquet-go/parquet-go"
 	"github.com/pidanou/c1-core/pkg/plugin"
 	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/awsconfig"
+	"github.com/pidanou/c1-plugins/internal/optschema"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/time/rate"
+)
+
+// s3API is the subset of the S3 API used by the connector. It is
+// implemented by *s3.Client.
+type s3API interface {
+	ListBuckets(ctx context.Context, params *s3.ListBucketsInput, optFns ...func(*s3.Options)) (*s3.ListBucketsOutput, error)
+	GetBucketLocation(ctx context.Context, params *s3.GetBucketLocationInput, optFns ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+	ListObjectVersions(ctx context.Context, params *s3.ListObjectVersionsInput, optFns ...func(*s3.Options)) (*s3.ListObjectVersionsOutput, error)
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+}
+
+var tracer = otel.Tracer("github.com/pidanou/c1-plugins/s3")
+
+// Sync metrics, served on C1_S3_METRICS_ADDR when it is set.
+var (
+	objectsSynced = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "c1_s3_objects_synced_total",
+		Help: "Objects sent to the host, by bucket.",
+	}, []string{"bucket"})
+	bucketsFailed = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "c1_s3_buckets_failed_total",
+		Help: "Buckets whose sync failed.",
+	})
+	syncDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "c1_s3_sync_duration_seconds",
+		Help:    "Duration of Sync calls.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	})
 )
 
 type S3Connector struct {
-	logger   hclog.Logger
-	S3Client *s3.Client
+	logger hclog.Logger
+	// redactor, when set, is given the secrets of every sync so that they
+	// are scrubbed from logger output.
+	redactor *redactor
+	// ctx is the parent context of every sync. It is cancelled when the
+	// plugin process is asked to terminate.
+	ctx context.Context
+}
+
+// account holds the S3 clients and caches of one profile. Each sync builds
+// its own, so concurrent syncs on the connector share none of them.
+type account struct {
+	logger hclog.Logger
+	client s3API
+	// region is the region of client and newClient builds a client for
+	// another region.
+	region    string
+	newClient func(region string) s3API
+	// regions caches the region of each bucket, clients the S3 client
+	// built for each region and created the creation date of the buckets
+	// returned by ListBuckets. All are guarded by mu.
+	mu      sync.Mutex
+	regions map[string]string
+	clients map[string]s3API
+	created map[string]time.Time
+	// inventory is the manifest read by connect for InventoryManifest.
+	inventory *inventoryManifest
 }
 
 type Options struct {
-	Profile string   `json:"profile"`
+	// Credentials holds the profile, region and credential options. The
+	// credentials are never included in String().
+	awsconfig.Credentials
+	// MaxKeys is the number of keys requested per listing page, up to
+	// 1000. It does not cap the number of objects synced; see
+	// MaxObjectsPerBucket.
 	MaxKeys int32    `json:"max_keys"`
 	Buckets []string `json:"buckets"`
-	Region  string   `json:"region"`
+	Prefix  string   `json:"prefix"`
+	// Concurrency is the number of buckets synced in parallel. Defaults
+	// to 1.
+	Concurrency int `json:"concurrency"`
+	// TimeoutSeconds bounds the whole sync. Zero means no timeout.
+	TimeoutSeconds int `json:"timeout_seconds"`
+	// MaxRetries and RetryMaxBackoffSeconds tune the SDK standard retryer.
+	// The SDK defaults are kept when they are zero.
+	MaxRetries             int `json:"max_retries"`
+	RetryMaxBackoffSeconds int `json:"retry_max_backoff_seconds"`
+	// FetchTags adds each object's tags to its metadata with a "tag:"
+	// prefix. This costs one GetObjectTagging request per object.
+	FetchTags bool `json:"fetch_tags"`
+	// Suffixes restricts synced objects to keys ending in one of these
+	// values, compared case-insensitively.
+	Suffixes []string `json:"suffixes"`
+	// Include and Exclude are path.Match glob patterns applied to object
+	// keys. A key matching any Exclude pattern is dropped even if it also
+	// matches an Include pattern.
+	Include []string `json:"include"`
+	Exclude []string `json:"exclude"`
+	// Endpoint overrides the S3 endpoint, e.g. for MinIO or other
+	// S3-compatible stores.
+	Endpoint string `json:"endpoint"`
+	// UsePathStyle switches to path-style addressing, which most
+	// S3-compatible servers require.
+	UsePathStyle bool `json:"use_path_style"`
+	// ModifiedSince is an RFC3339 timestamp. Objects last modified before
+	// it are skipped; objects without a modification time are kept.
+	ModifiedSince string `json:"modified_since"`
+	modifiedSince time.Time
+	// IncludeVersions lists every object version, delete markers
+	// included, instead of only current objects. The version ID and
+	// is_latest are added to the metadata and the version ID is appended
+	// to the ARN.
+	IncludeVersions bool `json:"include_versions"`
+	// TimeFormat is the Go time layout used for the last_modified
+	// metadata, or "unix" for epoch seconds. It defaults to RFC3339; note
+	// that earlier releases always used "2006-01-02 15:04:05".
+	TimeFormat string `json:"time_format"`
+	// Partition overrides the ARN partition (aws, aws-cn, aws-us-gov),
+	// which is otherwise derived from each bucket's region.
+	Partition string `json:"partition"`
+	// SkipFolders drops folder placeholders: objects whose key ends with
+	// "/" and whose size is 0 (or not reported).
+	SkipFolders bool `json:"skip_folders"`
+	// MinObjectSizeBytes and MaxObjectSizeBytes bound the size of synced
+	// objects, inclusive. A zero max means no upper bound.
+	MinObjectSizeBytes int64 `json:"min_object_size_bytes"`
+	MaxObjectSizeBytes int64 `json:"max_object_size_bytes"`
+	// BucketPattern is a regular expression selecting which of the
+	// account's buckets to sync. It cannot be combined with Buckets.
+	BucketPattern string `json:"bucket_pattern"`
+	// BatchSize is the number of DataObjects sent per callback. By default
+	// one callback is made per S3 page.
+	BatchSize int `json:"batch_size"`
+	// PresignExpirySeconds, when positive, replaces each DataObject URI
+	// with a presigned GET URL valid for that many seconds. RemoteId keeps
+	// the ARN.
+	PresignExpirySeconds int `json:"presign_expiry_seconds"`
+	// IncludeBuckets emits a DataObject for each synced bucket, with its
+	// region and, when known, its creation date.
+	IncludeBuckets bool `json:"include_buckets"`
+	// RequesterPays acknowledges that the requester is charged for
+	// requests to Requester Pays buckets.
+	RequesterPays bool `json:"requester_pays"`
+	// Profiles syncs the buckets of each listed shared config profile in
+	// turn and takes precedence over Profile. A bucket reachable from
+	// several profiles is synced once, with the first profile listing it.
+	Profiles []string `json:"profiles"`
+	// DryRun lists and filters objects as usual but sends nothing to the
+	// host; only the per-bucket and sync summaries are logged.
+	DryRun bool `json:"dry_run"`
+	// Delimiter is passed to the listing requests. Keys containing it
+	// after Prefix are rolled up into common prefixes, each emitted as a
+	// DataObject with is_prefix=true. Set it to "/" for a shallow catalog
+	// of the top-level folders.
+	Delimiter string `json:"delimiter"`
+	// CallbackRetries is how many times a failed callback is retried,
+	// with exponential backoff, before the bucket sync fails. It defaults
+	// to 3; 0 sends each batch once.
+	CallbackRetries int `json:"callback_retries"`
+	// CheckRestoreStatus adds restore_status (none, in-progress or
+	// restored) and restore_expiry to the metadata of GLACIER and
+	// DEEP_ARCHIVE objects. This costs one HeadObject request per archived
+	// object.
+	CheckRestoreStatus bool `json:"check_restore_status"`
+	// FetchEncryption adds sse_algorithm (AES256, aws:kms, ...) and
+	// kms_key_id to the metadata, "none" when absent. This costs one
+	// HeadObject request per object.
+	FetchEncryption bool `json:"fetch_encryption"`
+	// FetchOwner adds owner_id and owner_display_name to the metadata of
+	// objects whose owner S3 reports.
+	FetchOwner bool `json:"fetch_owner"`
+	// FetchChecksum adds the object's additional checksums (checksum_crc32,
+	// checksum_sha256, ...) to the metadata. This costs one HeadObject
+	// request per object with a checksum_algorithm.
+	FetchChecksum bool `json:"fetch_checksum"`
+	// RequestsPerSecond caps the rate of S3 requests made by the sync, all
+	// workers and regions combined. Zero means no limit.
+	RequestsPerSecond float64 `json:"requests_per_second"`
+	// FetchContentType adds content_type to the metadata, empty when S3
+	// has none. This costs one HeadObject request per object.
+	FetchContentType bool `json:"fetch_content_type"`
+	// Dedup drops DataObjects whose RemoteId was already emitted during
+	// the sync, as happens with a bucket listed twice or overlapping
+	// prefixes. It keeps every RemoteId in memory.
+	Dedup bool `json:"dedup"`
+	dedup *dedupSet
+	// Keys syncs only the listed keys of each bucket, read with one
+	// HeadObject request per key instead of listing the buckets.
+	Keys map[string][]string `json:"keys"`
+	// FetchTieringStatus adds intelligent_tiering_status to the metadata:
+	// the archive tier (ARCHIVE_ACCESS or DEEP_ARCHIVE_ACCESS) of
+	// INTELLIGENT_TIERING objects, and empty for objects in an access tier
+	// or another storage class. This costs one HeadObject request per
+	// INTELLIGENT_TIERING object.
+	FetchTieringStatus bool `json:"fetch_tiering_status"`
+	// RemoteIDTemplate and URITemplate are text/template formats for the
+	// RemoteId and Uri of objects and prefixes, e.g.
+	// "s3://{{.Bucket}}/{{.Key}}". They can use .Bucket, .Key, .Region and
+	// .VersionId, and default to the object ARN. A presigned URL still
+	// replaces the Uri.
+	RemoteIDTemplate string `json:"remote_id_template"`
+	URITemplate      string `json:"uri_template"`
+	remoteIDTemplate *template.Template
+	uriTemplate      *template.Template
+	// HTTPProxy, HTTPSProxy and NoProxy route S3 requests through a proxy.
+	// Each overrides the matching HTTP_PROXY, HTTPS_PROXY or NO_PROXY
+	// environment variable, which is used when the option is empty.
+	HTTPProxy  string `json:"http_proxy"`
+	HTTPSProxy string `json:"https_proxy"`
+	NoProxy    string `json:"no_proxy"`
+	// MaxObjectsPerBucket stops the listing of a bucket once that many
+	// objects and prefixes were emitted for it. Zero means no limit.
+	MaxObjectsPerBucket int `json:"max_objects_per_bucket"`
+	// InventoryManifest is the s3://bucket/key URI of the manifest.json of
+	// an S3 Inventory report in CSV or Parquet format. The report's source
+	// bucket is synced from the inventory files instead of being listed,
+	// which is much cheaper for very large buckets. Noncurrent versions
+	// in the report are skipped unless IncludeVersions is set, and Prefix
+	// filters the report's keys.
+	InventoryManifest string `json:"inventory_manifest"`
+	// EnrichConcurrency is the number of objects per bucket whose tag and
+	// HeadObject requests run in parallel. Defaults to 8.
+	EnrichConcurrency int `json:"enrich_concurrency"`
+	// StartAfter starts the listing of each bucket after this key, so an
+	// interrupted sync can resume from the last_key of its bucket summary.
+	// It only applies to the current-object listing and cannot be
+	// combined with include_versions, keys or inventory_manifest.
+	StartAfter string `json:"start_after"`
+	// DecodeKeys URL-decodes keys, with url.QueryUnescape, before they are
+	// used in the ResourceName, RemoteId and URI. Keys that fail to
+	// decode are kept as is. Filters and S3 requests use the raw key.
+	DecodeKeys bool `json:"decode_keys"`
+	// ShardWidth, when positive, lists a bucket as 16^ShardWidth key
+	// ranges split on hex prefixes after Prefix ("0" to "f" for 1, "00"
+	// to "ff" for 2), 16 of them at a time. It speeds up large buckets
+	// whose keys are evenly spread over hex prefixes, such as hashes or
+	// UUIDs. It is at most 3 and cannot be combined with include_versions,
+	// keys, inventory_manifest, start_after or max_objects_per_bucket.
+	ShardWidth int `json:"shard_width"`
+	// ExtractParquetSchema adds num_rows and a column:<path> entry with
+	// the type of each leaf column to the metadata of .parquet objects.
+	// Only the footer is read, with ranged GetObject requests (usually
+	// two per object), but it still costs requests for every file.
+	ExtractParquetSchema bool `json:"extract_parquet_schema"`
+	// MetadataFields, when not empty, restricts the metadata of every
+	// DataObject to these keys. An entry ending with "*" keeps every key
+	// with that prefix, such as "tag:*" or "column:*".
+	MetadataFields []string `json:"metadata_fields"`
 }
 
 func (o Options) String() string {
 	buckets := strings.Join(o.Buckets, ",")
-	return fmt.Sprint("profile: ", o.Profile, "maxkeys: ", o.MaxKeys, "buckets: ", buckets, "region: ", o.Region)
+	return fmt.Sprint("profile: ", o.Profile, "maxkeys: ", o.MaxKeys, "buckets: ", buckets, "region: ", o.Region, "prefix: ", o.Prefix,
+		"access_key_id: ", mask(o.AccessKeyID), "role_arn: ", o.RoleARN)
+}
+
+// mask hides all but the last four characters of s.
+func mask(s string) string {
+	if len(s) <= 4 {
+		return strings.Repeat("*", len(s))
+	}
+	return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+}
+
+// validate reports options that are invalid or conflict with each other.
+func (o Options) validate() error {
+	var errs []error
+	if o.MaxKeys < 0 || o.MaxKeys > 1000 {
+		errs = append(errs, fmt.Errorf("max_keys must be between 0 and 1000, got %d", o.MaxKeys))
+	}
+	if len(o.Buckets) > 0 && o.BucketPattern != "" {
+		errs = append(errs, errors.New("buckets and bucket_pattern are mutually exclusive"))
+	}
+	if len(o.Keys) > 0 && (len(o.Buckets) > 0 || o.BucketPattern != "" || o.IncludeVersions) {
+		errs = append(errs, errors.New("keys cannot be combined with buckets, bucket_pattern or include_versions"))
+	}
+	if o.InventoryManifest != "" {
+		if len(o.Buckets) > 0 || o.BucketPattern != "" || len(o.Keys) > 0 || o.Delimiter != "" {
+			errs = append(errs, errors.New("inventory_manifest cannot be combined with buckets, bucket_pattern, keys or delimiter"))
+		}
+		if _, _, err := parseS3URI(o.InventoryManifest); err != nil {
+			errs = append(errs, fmt.Errorf("invalid inventory_manifest: %w", err))
+		}
+	}
+	if o.StartAfter != "" && (o.IncludeVersions || len(o.Keys) > 0 || o.InventoryManifest != "") {
+		errs = append(errs, errors.New("start_after cannot be combined with include_versions, keys or inventory_manifest"))
+	}
+	if o.ShardWidth < 0 || o.ShardWidth > 3 {
+		errs = append(errs, fmt.Errorf("shard_width must be between 0 and 3, got %d", o.ShardWidth))
+	}
+	if o.ShardWidth > 0 && (o.IncludeVersions || len(o.Keys) > 0 || o.InventoryManifest != "" || o.StartAfter != "" || o.MaxObjectsPerBucket > 0) {
+		errs = append(errs, errors.New("shard_width cannot be combined with include_versions, keys, inventory_manifest, start_after or max_objects_per_bucket"))
+	}
+	if o.EnrichConcurrency < 0 {
+		errs = append(errs, fmt.Errorf("enrich_concurrency must not be negative, got %d", o.EnrichConcurrency))
+	}
+	if o.MaxObjectsPerBucket < 0 {
+		errs = append(errs, fmt.Errorf("max_objects_per_bucket must not be negative, got %d", o.MaxObjectsPerBucket))
+	}
+	if o.Concurrency < 0 {
+		errs = append(errs, fmt.Errorf("concurrency must not be negative, got %d", o.Concurrency))
+	}
+	if o.TimeoutSeconds < 0 {
+		errs = append(errs, fmt.Errorf("timeout_seconds must not be negative, got %d", o.TimeoutSeconds))
+	}
+	if o.MaxRetries < 0 || o.RetryMaxBackoffSeconds < 0 {
+		errs = append(errs, errors.New("max_retries and retry_max_backoff_seconds must not be negative"))
+	}
+	if o.BatchSize < 0 {
+		errs = append(errs, fmt.Errorf("batch_size must not be negative, got %d", o.BatchSize))
+	}
+	if o.RequestsPerSecond < 0 {
+		errs = append(errs, fmt.Errorf("requests_per_second must not be negative, got %v", o.RequestsPerSecond))
+	}
+	if o.CallbackRetries < 0 {
+		errs = append(errs, fmt.Errorf("callback_retries must not be negative, got %d", o.CallbackRetries))
+	}
+	if o.PresignExpirySeconds < 0 {
+		errs = append(errs, fmt.Errorf("presign_expiry_seconds must not be negative, got %d", o.PresignExpirySeconds))
+	}
+	if o.MinObjectSizeBytes < 0 || o.MaxObjectSizeBytes < 0 {
+		errs = append(errs, errors.New("object size bounds must not be negative"))
+	}
+	if o.MaxObjectSizeBytes > 0 && o.MinObjectSizeBytes > o.MaxObjectSizeBytes {
+		errs = append(errs, errors.New("min_object_size_bytes is greater than max_object_size_bytes"))
+	}
+	if (o.AccessKeyID == "") != (o.SecretAccessKey == "") {
+		errs = append(errs, errors.New("access_key_id and secret_access_key must be set together"))
+	}
+	if o.SessionToken != "" && o.AccessKeyID == "" {
+		errs = append(errs, errors.New("session_token requires access_key_id and secret_access_key"))
+	}
+	if len(o.Profiles) > 0 && o.AccessKeyID != "" {
+		errs = append(errs, errors.New("profiles and access_key_id are mutually exclusive"))
+	}
+	if (o.ExternalID != "" || o.RoleSessionName != "") && o.RoleARN == "" {
+		errs = append(errs, errors.New("external_id and role_session_name require role_arn"))
+	}
+	for _, proxy := range []struct{ name, url string }{{"http_proxy", o.HTTPProxy}, {"https_proxy", o.HTTPSProxy}} {
+		if proxy.url == "" {
+			continue
+		}
+		if u, err := url.Parse(proxy.url); err != nil || u.Host == "" {
+			errs = append(errs, fmt.Errorf("invalid %s %q", proxy.name, proxy.url))
+		}
+	}
+	for _, pattern := range append(o.Include, o.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			errs = append(errs, fmt.Errorf("invalid pattern %q: %w", pattern, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// awsLoadOptions returns the AWS config options for the retry, rate limit and
+// proxy options.
+func awsLoadOptions(opts Options) []func(*config.LoadOptions) error {
+	var loadOptions []func(*config.LoadOptions) error
+	if opts.MaxRetries > 0 || opts.RetryMaxBackoffSeconds > 0 {
+		loadOptions = append(loadOptions, config.WithRetryer(func() aws.Retryer {
+			return retry.NewStandard(func(o *retry.StandardOptions) {
+				if opts.MaxRetries > 0 {
+					o.MaxAttempts = opts.MaxRetries + 1
+				}
+				if opts.RetryMaxBackoffSeconds > 0 {
+					o.MaxBackoff = time.Duration(opts.RetryMaxBackoffSeconds) * time.Second
+				}
+			})
+		}))
+	}
+	if opts.RequestsPerSecond > 0 {
+		limiter := rate.NewLimiter(rate.Limit(opts.RequestsPerSecond), 1)
+		loadOptions = append(loadOptions, config.WithAPIOptions([]func(*middleware.Stack) error{
+			func(stack *middleware.Stack) error {
+				// After the retry middleware, so every attempt waits.
+				if _, ok := stack.Finalize.Get("Retry"); ok {
+					return stack.Finalize.Insert(rateLimit(limiter), "Retry", middleware.After)
+				}
+				return stack.Finalize.Add(rateLimit(limiter), middleware.Before)
+			},
+		}))
+	}
+	if opts.HTTPProxy != "" || opts.HTTPSProxy != "" || opts.NoProxy != "" {
+		loadOptions = append(loadOptions, config.WithHTTPClient(proxyClient(opts)))
+	}
+	return loadOptions
+}
+
+// Describe returns the JSON schema of the options accepted by Sync. The c1
+// plugin protocol only carries Sync, so hosts cannot call it over gRPC yet;
+// they run the plugin with -describe instead, which prints it.
+func (s *S3Connector) Describe() (string, error) {
+	schema, err := optschema.Generate(Options{})
+	return string(schema), err
 }
 
 func (s *S3Connector) Sync(options string, cb plugin.CallbackHandler) error {
+	start := time.Now()
+	defer func() { syncDuration.Observe(time.Since(start).Seconds()) }()
 
-	var opts Options
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracer.Start(ctx, "Sync")
+	defer span.End()
+
+	err := s.sync(ctx, options, cb)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "sync failed")
+	}
+	return err
+}
 
-	err := json.Unmarshal([]byte(options), &opts)
+func (s *S3Connector) sync(ctx context.Context, options string, cb plugin.CallbackHandler) error {
+	opts := Options{CallbackRetries: callbackRetries}
+
+	err := pluginserve.DecodeOptions(options, &opts)
 	if err != nil {
 		s.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+
+	if s.redactor != nil {
+		s.redactor.add(opts.AccessKeyID, opts.SecretAccessKey, opts.SessionToken, opts.ExternalID)
+	}
+
+	if err := opts.validate(); err != nil {
+		s.logger.Error("Invalid options", "error", err)
+		return fmt.Errorf("invalid options: %w", err)
+	}
+
+	var bucketPattern *regexp.Regexp
+	if opts.BucketPattern != "" {
+		bucketPattern, err = regexp.Compile(opts.BucketPattern)
+		if err != nil {
+			return fmt.Errorf("invalid bucket_pattern %q: %w", opts.BucketPattern, err)
+		}
+	}
+
+	opts.remoteIDTemplate, err = parseTemplate("remote_id_template", opts.RemoteIDTemplate)
+	if err != nil {
+		return err
+	}
+	opts.uriTemplate, err = parseTemplate("uri_template", opts.URITemplate)
+	if err != nil {
+		return err
+	}
+
+	if opts.Dedup {
+		opts.dedup = &dedupSet{seen: map[string]struct{}{}}
+	}
+
+	if opts.ModifiedSince != "" {
+		opts.modifiedSince, err = time.Parse(time.RFC3339, opts.ModifiedSince)
+		if err != nil {
+			return fmt.Errorf("invalid modified_since %q: %w", opts.ModifiedSince, err)
+		}
+	}
+
+	if opts.TimeoutSeconds > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(opts.TimeoutSeconds)*time.Second)
+		defer cancel()
+	}
+
+	loadOptions := awsLoadOptions(opts)
+
+	profiles := opts.Profiles
+	if len(profiles) == 0 {
+		profiles = []string{opts.Profile}
+	}
+	if opts.DryRun {
+		s.logger.Info("Dry run, objects will not be sent")
+		cb = discardCallbackHandler{}
+	}
+	cb = &lockedCallbackHandler{cb: cb}
+
+	// An empty response checks the host stream before any listing work,
+	// which could otherwise run for minutes before the first flush fails.
+	if _, err := cb.Callback(&proto.SyncResponse{}); err != nil {
+		s.logger.Error("Host callback failed", "error", err)
+		return fmt.Errorf("host callback failed: %w", err)
+	}
+
+	res := &syncResult{skipped: map[string]string{}}
+	// seen holds the bucket ARNs synced so far, so that a bucket reachable
+	// from several profiles is synced once. A single profile lists every
+	// bucket once and does not need it.
+	var seen map[string]bool
+	if len(profiles) > 1 {
+		seen = map[string]bool{}
+	}
+	for _, profile := range profiles {
+		if err := ctx.Err(); err != nil {
+			res.errs = append(res.errs, err)
+			break
+		}
+		a, buckets, err := s.connect(ctx, profile, opts, bucketPattern, loadOptions)
+		if err != nil {
+			if len(opts.Profiles) == 0 {
+				return err
+			}
+			s.logger.Error("Failed to sync profile", "profile", profile, "error", err)
+			res.errs = append(res.errs, fmt.Errorf("profile %s: %w", profile, err))
+			continue
+		}
+		partition := opts.Partition
+		if partition == "" {
+			partition = partitionForRegion(a.region)
+		}
+		if err := s.syncBuckets(ctx, a, buckets.filter(func(bucket string) bool {
+			if seen != nil {
+				arn := fmt.Sprintf(`arn:%s:s3:::%s`, partition, bucket)
+				if seen[arn] {
+					return false
+				}
+				seen[arn] = true
+			}
+			res.buckets++
+			return true
+		}), opts, cb, res); err != nil {
+			if len(opts.Profiles) == 0 {
+				res.errs = append(res.errs, err)
+			} else {
+				res.errs = append(res.errs, fmt.Errorf("profile %s: %w", profile, err))
+			}
+		}
 	}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(opts.Region),
-		config.WithSharedConfigProfile(opts.Profile),
+	s.logger.Info("Sync summary",
+		"buckets", res.buckets,
+		"objects_synced", res.total.Objects,
+		"bytes_total", res.total.Bytes,
+		"buckets_failed", res.failed,
+		"buckets_skipped", res.skipped,
+		"dry_run", opts.DryRun,
 	)
+	return errors.Join(res.errs...)
+}
+
+// bucketSource yields the buckets to sync until yield returns false, and
+// returns the error that ended the listing early, if any.
+type bucketSource func(yield func(bucket string) bool) error
+
+// bucketSlice returns a bucketSource yielding buckets.
+func bucketSlice(buckets []string) bucketSource {
+	return func(yield func(string) bool) error {
+		for _, bucket := range buckets {
+			if !yield(bucket) {
+				return nil
+			}
+		}
+		return nil
+	}
+}
+
+// filter returns a bucketSource yielding the buckets of src for which keep
+// returns true.
+func (src bucketSource) filter(keep func(bucket string) bool) bucketSource {
+	return func(yield func(string) bool) error {
+		return src(func(bucket string) bool {
+			return !keep(bucket) || yield(bucket)
+		})
+	}
+}
+
+// configure loads the AWS config of profile and returns the account with
+// the S3 clients for it.
+func (s *S3Connector) configure(ctx context.Context, profile string, opts Options, loadOptions []func(*config.LoadOptions) error) (*account, error) {
+	creds := opts.Credentials
+	creds.Profile = profile
+	cfg, err := awsconfig.Load(ctx, creds, loadOptions...)
+	if err != nil {
+		s.logger.Error("Failed to load AWS config", "error", err)
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
 
 	// Create S3 service client
-	svc := s3.NewFromConfig(cfg)
-	s.S3Client = svc
+	svc := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
+	region := svc.Options().Region
+	return &account{
+		logger: s.logger,
+		client: svc,
+		region: region,
+		newClient: func(region string) s3API {
+			return s3.New(svc.Options(), func(o *s3.Options) {
+				o.Region = region
+			})
+		},
+		regions: map[string]string{},
+		clients: map[string]s3API{region: svc},
+		created: map[string]time.Time{},
+	}, nil
+}
+
+// Check verifies that the credentials and region of options can reach S3,
+// without syncing anything. Each profile calls HeadBucket on the first
+// configured bucket, or ListBuckets for a single bucket when none is
+// configured.
+func (s *S3Connector) Check(options string) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if s.redactor != nil {
+		s.redactor.add(opts.AccessKeyID, opts.SecretAccessKey, opts.SessionToken, opts.ExternalID)
+	}
+	if err := opts.validate(); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	profiles := opts.Profiles
+	if len(profiles) == 0 {
+		profiles = []string{opts.Profile}
+	}
+	bucket := ""
+	switch {
+	case len(opts.Keys) > 0:
+		bucket = slices.Min(slices.Collect(maps.Keys(opts.Keys)))
+	case len(opts.Buckets) > 0:
+		bucket = opts.Buckets[0]
+	case opts.InventoryManifest != "":
+		bucket, _, _ = parseS3URI(opts.InventoryManifest)
+	}
+
+	var errs []error
+	fail := func(profile string, err error) {
+		if len(opts.Profiles) > 0 {
+			err = fmt.Errorf("profile %s: %w", profile, err)
+		}
+		errs = append(errs, err)
+	}
+	for _, profile := range profiles {
+		a, err := s.configure(ctx, profile, opts, awsLoadOptions(opts))
+		if err != nil {
+			fail(profile, err)
+			continue
+		}
+		if bucket != "" {
+			client, _ := a.clientForBucket(ctx, bucket)
+			_, err = client.HeadBucket(ctx, &s3.HeadBucketInput{Bucket: &bucket})
+		} else {
+			_, err = a.client.ListBuckets(ctx, &s3.ListBucketsInput{MaxBuckets: aws.Int32(1)})
+		}
+		if err != nil {
+			fail(profile, classify(err))
+			continue
+		}
+		s.logger.Info("Connection check passed", "profile", profile, "region", a.region, "bucket", bucket)
+	}
+	return errors.Join(errs...)
+}
 
-	var buckets []string
+// connect returns the account of profile and the buckets to sync there.
+// Listed buckets are streamed page by page as the sync consumes them.
+func (s *S3Connector) connect(ctx context.Context, profile string, opts Options, bucketPattern *regexp.Regexp, loadOptions []func(*config.LoadOptions) error) (*account, bucketSource, error) {
+	a, err := s.configure(ctx, profile, opts, loadOptions)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.InventoryManifest != "" {
+		a.inventory, err = a.readManifest(ctx, opts)
+		if err != nil {
+			err = classify(err)
+			s.logger.Warn("Failed to read inventory manifest", "code", errorCode(err), "error", err)
+			return nil, nil, err
+		}
+		return a, bucketSlice([]string{a.inventory.SourceBucket}), nil
+	}
+	if len(opts.Keys) > 0 {
+		buckets := slices.Collect(maps.Keys(opts.Keys))
+		slices.Sort(buckets)
+		return a, bucketSlice(buckets), nil
+	}
 	if opts.Buckets != nil {
-		buckets = opts.Buckets
-	} else {
-		buckets, err = s.listBuckets()
+		return a, bucketSlice(opts.Buckets), nil
+	}
+	var buckets bucketSource = func(yield func(string) bool) error {
+		err := a.listBuckets(ctx, yield)
 		if err != nil {
-			s.logger.Warn("Failed to list buckets", err)
-			return err
+			err = classify(err)
+			s.logger.Warn("Failed to list buckets", "code", errorCode(err), "error", err)
+		}
+		return err
+	}
+	if bucketPattern != nil {
+		buckets = buckets.filter(bucketPattern.MatchString)
+	}
+	return a, buckets, nil
+}
+
+// syncResult accumulates the outcome of syncing buckets across profiles.
+type syncResult struct {
+	// buckets counts the buckets handed to the workers.
+	buckets int
+	total   bucketSummary
+	failed  []string
+	// skipped maps buckets the credentials cannot read to the reason,
+	// so they are not mistaken for empty buckets.
+	skipped map[string]string
+	errs    []error
+}
+
+// syncBuckets syncs buckets of a with opts.Concurrency workers and adds the
+// outcome to res. It returns the error that stopped the bucket listing.
+func (s *S3Connector) syncBuckets(ctx context.Context, a *account, buckets bucketSource, opts Options, cb plugin.CallbackHandler, res *syncResult) error {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	jobs := make(chan string)
+	for range concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for bucket := range jobs {
+				summary, err := s.listObjects(ctx, a, bucket, opts, cb)
+				reason, denied := accessDenied(err)
+				switch {
+				case denied:
+					s.logger.Warn("Skipping bucket, access denied", "bucket", bucket, "reason", reason)
+				case err != nil:
+					err = classify(err)
+					s.logger.Warn("Failed to sync bucket", "bucket", bucket, "code", errorCode(err), "last_key", summary.LastKey, "error", err)
+					bucketsFailed.Inc()
+				default:
+					s.logger.Info("Synced bucket", "bucket", bucket, "objects_synced", summary.Objects, "bytes_total", summary.Bytes, "last_key", summary.LastKey)
+				}
+				objectsSynced.WithLabelValues(bucket).Add(float64(summary.Objects))
+				mu.Lock()
+				res.total.Objects += summary.Objects
+				res.total.Bytes += summary.Bytes
+				switch {
+				case denied:
+					res.skipped[bucket] = reason
+				case err != nil:
+					res.errs = append(res.errs, fmt.Errorf("bucket %s: %w", bucket, err))
+					res.failed = append(res.failed, bucket)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	err := buckets(func(bucket string) bool {
+		select {
+		case jobs <- bucket:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+	close(jobs)
+	wg.Wait()
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// discardCallbackHandler drops every response, for dry runs.
+type discardCallbackHandler struct{}
+
+func (discardCallbackHandler) Callback(*proto.SyncResponse) (*proto.Empty, error) {
+	return &proto.Empty{}, nil
+}
+
+// Error categories of the failures reported to the host. Reported errors
+// match one of them with errors.Is and their text starts with its code,
+// such as "throttled: ...".
+var (
+	ErrAccessDenied = errors.New("access_denied")
+	ErrNotFound     = errors.New("not_found")
+	ErrThrottled    = errors.New("throttled")
+	ErrNetwork      = errors.New("network")
+	ErrCanceled     = errors.New("canceled")
+	ErrUnknown      = errors.New("unknown")
+)
+
+// categorizedError is an error tagged with one of the error categories.
+type categorizedError struct {
+	category error
+	err      error
+}
+
+func (e *categorizedError) Error() string {
+	return e.category.Error() + ": " + e.err.Error()
+}
+
+func (e *categorizedError) Unwrap() []error {
+	return []error{e.category, e.err}
+}
+
+// classify tags err with its error category.
+func classify(err error) error {
+	var c *categorizedError
+	if err == nil || errors.As(err, &c) {
+		return err
+	}
+	return &categorizedError{category: category(err), err: err}
+}
+
+func category(err error) error {
+	if _, ok := accessDenied(err); ok {
+		return ErrAccessDenied
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchBucket", "NoSuchKey", "NotFound":
+			return ErrNotFound
+		}
+		if _, ok := retry.DefaultThrottleErrorCodes[apiErr.ErrorCode()]; ok {
+			return ErrThrottled
+		}
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		switch respErr.HTTPStatusCode() {
+		case http.StatusNotFound:
+			return ErrNotFound
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			return ErrThrottled
+		}
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrCanceled
+	}
+	var sendErr *smithyhttp.RequestSendError
+	var netErr net.Error
+	if errors.As(err, &sendErr) || errors.As(err, &netErr) {
+		return ErrNetwork
+	}
+	return ErrUnknown
+}
+
+// errorCode returns the category code of a classified error.
+func errorCode(err error) string {
+	var c *categorizedError
+	if errors.As(err, &c) {
+		return c.category.Error()
+	}
+	return ErrUnknown.Error()
+}
+
+// accessDenied reports whether err is an S3 AccessDenied or 403 response,
+// and returns the reason given by S3.
+func accessDenied(err error) (string, bool) {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && (apiErr.ErrorCode() == "AccessDenied" || apiErr.ErrorCode() == "AllAccessDisabled") {
+		if msg := apiErr.ErrorMessage(); msg != "" {
+			return msg, true
+		}
+		return apiErr.ErrorCode(), true
+	}
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusForbidden {
+		return http.StatusText(http.StatusForbidden), true
+	}
+	return "", false
+}
+
+// rateLimit returns a middleware waiting for limiter before every request
+// attempt, retries included.
+func rateLimit(limiter *rate.Limiter) middleware.FinalizeMiddleware {
+	return middleware.FinalizeMiddlewareFunc("RateLimit", func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, err
 		}
+		return next.HandleFinalize(ctx, in)
+	})
+}
+
+// proxyClient returns the SDK's default HTTP client with the proxy options
+// layered over the proxy environment variables.
+func proxyClient(opts Options) *awshttp.BuildableClient {
+	proxy := httpproxy.FromEnvironment()
+	if opts.HTTPProxy != "" {
+		proxy.HTTPProxy = opts.HTTPProxy
+	}
+	if opts.HTTPSProxy != "" {
+		proxy.HTTPSProxy = opts.HTTPSProxy
+	}
+	if opts.NoProxy != "" {
+		proxy.NoProxy = opts.NoProxy
 	}
+	proxyFunc := proxy.ProxyFunc()
+	return awshttp.NewBuildableClient().WithTransportOptions(func(tr *http.Transport) {
+		tr.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	})
+}
+
+// lockedCallbackHandler serializes calls to the wrapped handler so it can be
+// shared by the bucket workers.
+type lockedCallbackHandler struct {
+	mu sync.Mutex
+	cb plugin.CallbackHandler
+}
+
+func (l *lockedCallbackHandler) Callback(res *proto.SyncResponse) (*proto.Empty, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.cb.Callback(res)
+}
+
+// bucketPageSize is the number of buckets requested per ListBuckets page.
+const bucketPageSize = 1000
 
-	for _, bucket := range buckets {
-		s.listObjects(bucket, opts, cb)
+// listBuckets pages through ListBuckets and passes every bucket to yield,
+// stopping early when yield returns false.
+func (a *account) listBuckets(ctx context.Context, yield func(bucket string) bool) error {
+	ctx, span := tracer.Start(ctx, "listBuckets")
+	defer span.End()
+
+	p := s3.NewListBucketsPaginator(a.client, &s3.ListBucketsInput{}, func(o *s3.ListBucketsPaginatorOptions) {
+		o.Limit = bucketPageSize
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return err
+		}
+		for _, bucket := range page.Buckets {
+			var noname = ""
+			if bucket.Name == nil {
+				bucket.Name = &noname
+			}
+			if bucket.CreationDate != nil {
+				a.mu.Lock()
+				a.created[*bucket.Name] = *bucket.CreationDate
+				a.mu.Unlock()
+			}
+			if !yield(*bucket.Name) {
+				return nil
+			}
+		}
 	}
 	return nil
 }
 
-func (s *S3Connector) listBuckets() ([]string, error) {
-	res := []string{}
-	result, err := s.S3Client.ListBuckets(context.Background(), &s3.ListBucketsInput{})
-	if err != nil {
-		return nil, err
+// clientForBucket returns an S3 client configured for the bucket's region,
+// falling back to the default client when the region cannot be resolved.
+func (a *account) clientForBucket(ctx context.Context, bucket string) (s3API, string) {
+	a.mu.Lock()
+	region, ok := a.regions[bucket]
+	a.mu.Unlock()
+	if !ok {
+		region = a.region
+		location, err := a.client.GetBucketLocation(ctx, &s3.GetBucketLocationInput{Bucket: &bucket})
+		if err != nil {
+			a.logger.Warn("Failed to get bucket location", "bucket", bucket, "error", err)
+		} else {
+			region = bucketRegion(location.LocationConstraint)
+		}
+		a.mu.Lock()
+		a.regions[bucket] = region
+		a.mu.Unlock()
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	client, ok := a.clients[region]
+	if !ok {
+		client = a.newClient(region)
+		a.clients[region] = client
+	}
+	return client, region
+}
+
+// bucketRegion maps a GetBucketLocation constraint to a region name. S3
+// reports us-east-1 as an empty constraint and legacy eu-west-1 as "EU".
+func bucketRegion(constraint types.BucketLocationConstraint) string {
+	switch constraint {
+	case "":
+		return "us-east-1"
+	case types.BucketLocationConstraintEu:
+		return "eu-west-1"
+	}
+	return string(constraint)
+}
+
+func (s *S3Connector) listObjects(ctx context.Context, a *account, bucket string, opts Options, cb plugin.CallbackHandler) (summary bucketSummary, err error) {
+	ctx, span := tracer.Start(ctx, "listObjects", trace.WithAttributes(attribute.String("bucket", bucket)))
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("objects", summary.Objects),
+			attribute.Int("pages", summary.Pages),
+			attribute.String("last_key", summary.LastKey),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "bucket sync failed")
+		}
+		span.End()
+	}()
+
+	client, region := a.clientForBucket(ctx, bucket)
+	l := &bucketLister{
+		logger:    s.logger,
+		client:    client,
+		bucket:    bucket,
+		region:    region,
+		partition: opts.Partition,
+		opts:      opts,
+		batch:     newBatcher(ctx, cb, opts),
+	}
+	if l.partition == "" {
+		l.partition = partitionForRegion(region)
+	}
+	if opts.PresignExpirySeconds > 0 {
+		c, ok := client.(*s3.Client)
+		if !ok {
+			return bucketSummary{}, errors.New("presigned URLs require an *s3.Client")
+		}
+		l.presigner = s3.NewPresignClient(c, s3.WithPresignExpires(time.Duration(opts.PresignExpirySeconds)*time.Second))
 	}
-	for _, bucket := range result.Buckets {
-		var noname = ""
-		if bucket.Name == nil {
-			bucket.Name = &noname
+
+	if opts.IncludeBuckets {
+		a.mu.Lock()
+		created, ok := a.created[bucket]
+		a.mu.Unlock()
+		creationDate := ""
+		if ok {
+			creationDate = formatTime(created, opts.TimeFormat)
+		}
+		arn := fmt.Sprintf(`arn:%s:s3:::%s`, l.partition, bucket)
+		if !opts.dedup.add(arn) {
+			return bucketSummary{}, nil
 		}
-		res = append(res, *bucket.Name)
+		l.batch.add(&proto.DataObject{
+			RemoteId:     arn,
+			ResourceName: bucket,
+			Uri:          arn,
+			Metadata: map[string]string{
+				"creation_date": creationDate,
+				"region":        region,
+			}})
+	}
+
+	switch {
+	case opts.InventoryManifest != "":
+		inventoryClient, _ := a.clientForBucket(ctx, a.inventory.bucket)
+		err = l.listInventory(ctx, a.inventory, inventoryClient)
+	case len(opts.Keys) > 0:
+		err = l.headKeys(ctx, opts.Keys[bucket])
+	case opts.IncludeVersions:
+		err = l.listObjectVersions(ctx)
+	default:
+		err = l.listObjects(ctx)
+	}
+	return l.summary, err
+}
+
+// bucketLister lists the objects of a single bucket and sends them to the
+// callback.
+type bucketLister struct {
+	logger    hclog.Logger
+	client    s3API
+	presigner *s3.PresignClient
+	bucket    string
+	region    string
+	partition string
+	opts      Options
+	batch     *batcher
+	summary   bucketSummary
+	// listed is the greatest key or prefix handed to the batch.
+	listed string
+}
+
+// bucketSummary counts the objects sent for a bucket.
+type bucketSummary struct {
+	Objects int
+	Bytes   int64
+	Pages   int
+	// LastKey is the last key of the current-object listing whose
+	// DataObjects were all sent, for use as start_after. Sharded listings
+	// leave it empty.
+	LastKey string
+}
+
+func (l *bucketLister) listObjects(ctx context.Context) error {
+	if l.opts.ShardWidth > 0 {
+		return l.listShards(ctx)
 	}
-	return res, nil
+	return l.listRange(ctx, l.opts.StartAfter, "")
 }
 
-func (s *S3Connector) listObjects(bucket string, opts Options, cb plugin.CallbackHandler) {
+// listRange lists the keys after startAfter up to and including end, or to
+// the end of the bucket when end is empty.
+func (l *bucketLister) listRange(ctx context.Context, startAfter, end string) error {
 	params := &s3.ListObjectsV2Input{
-		Bucket: &bucket,
+		Bucket: &l.bucket,
+	}
+	if l.opts.Prefix != "" {
+		params.Prefix = &l.opts.Prefix
 	}
-	p := s3.NewListObjectsV2Paginator(s.S3Client, params, func(o *s3.ListObjectsV2PaginatorOptions) {
-		if v := int32(opts.MaxKeys); v != 0 {
+	if l.opts.Delimiter != "" {
+		params.Delimiter = &l.opts.Delimiter
+	}
+	if startAfter != "" {
+		params.StartAfter = &startAfter
+	}
+	if l.opts.FetchOwner {
+		params.FetchOwner = aws.Bool(true)
+	}
+	params.RequestPayer = l.requestPayer()
+	p := s3.NewListObjectsV2Paginator(l.client, params, func(o *s3.ListObjectsV2PaginatorOptions) {
+		if v := int32(l.opts.MaxKeys); v != 0 {
 			o.Limit = v
 		}
 	})
 	var i int
 	for p.HasMorePages() {
 		i++
-		page, err := p.NextPage(context.TODO())
+		page, err := p.NextPage(ctx)
 		if err != nil {
-			s.logger.Warn("failed to get page %v, %v", i, err)
+			return fmt.Errorf("failed to get page %v: %w", i, err)
 		}
+		l.summary.Pages++
 
-		res := []*proto.DataObject{}
-		for _, obj := range page.Contents {
-			arn := fmt.Sprintf(`arn:aws:s3:::%s/%s`, bucket, *obj.Key)
-			lastModified := ""
-			if obj.LastModified != nil {
-				lastModified = obj.LastModified.Format("2006-01-02 15:04:05")
-			}
+		// Keys and prefixes are returned in order, so the range ends at
+		// the first one past end.
+		contents, prefixes := page.Contents, page.CommonPrefixes
+		done := false
+		if end != "" {
+			n := len(contents)
+			contents = slices.DeleteFunc(slices.Clone(contents), func(obj types.Object) bool {
+				return aws.ToString(obj.Key) > end
+			})
+			m := len(prefixes)
+			prefixes = slices.DeleteFunc(slices.Clone(prefixes), func(p types.CommonPrefix) bool {
+				return aws.ToString(p.Prefix) > end
+			})
+			done = len(contents) < n || len(prefixes) < m
+		}
 
-			res = append(res, &proto.DataObject{
-				RemoteId:     arn,
-				ResourceName: *obj.Key,
-				Uri:          arn,
-				Metadata:     map[string]string{"last_modified": lastModified}})
+		objects := make([]object, 0, len(contents))
+		for _, obj := range contents {
+			objects = append(objects, object{
+				Key:          aws.ToString(obj.Key),
+				LastModified: obj.LastModified,
+				Size:         obj.Size,
+				ETag:         obj.ETag,
+				StorageClass: string(obj.StorageClass),
+				Owner:        obj.Owner,
+				Checksums:    obj.ChecksumAlgorithm,
+			})
+		}
+		l.sendObjects(ctx, objects)
+		l.sendPrefixes(prefixes)
+		if err := l.batch.EndPage(); err != nil {
+			return err
+		}
+		if l.batch.Len() == 0 {
+			l.summary.LastKey = l.listed
+		}
+		if l.full() {
+			l.logger.Info("Reached max_objects_per_bucket", "bucket", l.bucket, "objects", l.summary.Objects)
+			break
+		}
+		if done {
+			break
 		}
-		// Ignore proto.Empty, error response
-		_, _ = cb.Callback(&proto.SyncResponse{Response: res})
 	}
+	if err := l.batch.Flush(); err != nil {
+		return err
+	}
+	l.summary.LastKey = l.listed
+	return nil
 }
 
-var handshakeConfig = goplugin.HandshakeConfig{
-	ProtocolVersion:  1,
-	MagicCookieKey:   "BASIC_PLUGIN",
-	MagicCookieValue: "hello",
+// shardWorkers is the number of shards of a bucket listed at once.
+const shardWorkers = 16
+
+// listShards splits the keys after Prefix into ranges bounded by every hex
+// string of ShardWidth characters and lists them concurrently. Keys that do
+// not start with a hex digit still fall in one of the ranges, so only the
+// balance between shards depends on the key distribution.
+func (l *bucketLister) listShards(ctx context.Context) error {
+	// Send what listObjects already batched, such as the bucket itself.
+	if err := l.batch.Flush(); err != nil {
+		return err
+	}
+
+	n := 1 << (4 * l.opts.ShardWidth)
+	bounds := make([]string, n+1)
+	for i := 1; i < n; i++ {
+		bounds[i] = l.opts.Prefix + fmt.Sprintf("%0*x", l.opts.ShardWidth, i)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	// Each shard lists with its own batch and summary, added to l's below.
+	base := *l
+	base.summary = bucketSummary{}
+	base.listed = ""
+	shards := make(chan int)
+	for range min(shardWorkers, n) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range shards {
+				shard := base
+				shard.batch = newBatcher(ctx, l.batch.cb, l.opts)
+				err := shard.listRange(ctx, bounds[i], bounds[i+1])
+				mu.Lock()
+				l.summary.Objects += shard.summary.Objects
+				l.summary.Bytes += shard.summary.Bytes
+				l.summary.Pages += shard.summary.Pages
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("shard %d: %w", i, err)
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range n {
+		select {
+		case shards <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(shards)
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
 }
 
-func main() {
-	logger := hclog.New(&hclog.LoggerOptions{
-		Level:      hclog.Trace,
-		Output:     os.Stderr,
-		JSONFormat: true,
+// listObjectVersions is the IncludeVersions variant of listObjects. It emits
+// one DataObject per object version, delete markers included.
+func (l *bucketLister) listObjectVersions(ctx context.Context) error {
+	params := &s3.ListObjectVersionsInput{
+		Bucket: &l.bucket,
+	}
+	if l.opts.Prefix != "" {
+		params.Prefix = &l.opts.Prefix
+	}
+	if l.opts.Delimiter != "" {
+		params.Delimiter = &l.opts.Delimiter
+	}
+	params.RequestPayer = l.requestPayer()
+	p := s3.NewListObjectVersionsPaginator(l.client, params, func(o *s3.ListObjectVersionsPaginatorOptions) {
+		if v := int32(l.opts.MaxKeys); v != 0 {
+			o.Limit = v
+		}
 	})
+	var i int
+	for p.HasMorePages() {
+		i++
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get page %v: %w", i, err)
+		}
+		l.summary.Pages++
+
+		objects := make([]object, 0, len(page.Versions)+len(page.DeleteMarkers))
+		for _, v := range page.Versions {
+			objects = append(objects, object{
+				Key:          aws.ToString(v.Key),
+				LastModified: v.LastModified,
+				Size:         v.Size,
+				ETag:         v.ETag,
+				StorageClass: string(v.StorageClass),
+				VersionID:    aws.ToString(v.VersionId),
+				IsLatest:     aws.ToBool(v.IsLatest),
+				Owner:        v.Owner,
+				Checksums:    v.ChecksumAlgorithm,
+			})
+		}
+		for _, m := range page.DeleteMarkers {
+			objects = append(objects, object{
+				Key:          aws.ToString(m.Key),
+				LastModified: m.LastModified,
+				VersionID:    aws.ToString(m.VersionId),
+				IsLatest:     aws.ToBool(m.IsLatest),
+				DeleteMarker: true,
+				Owner:        m.Owner,
+			})
+		}
+		l.sendObjects(ctx, objects)
+		l.sendPrefixes(page.CommonPrefixes)
+		if err := l.batch.EndPage(); err != nil {
+			return err
+		}
+		if l.full() {
+			l.logger.Info("Reached max_objects_per_bucket", "bucket", l.bucket, "objects", l.summary.Objects)
+			break
+		}
+	}
+	return l.batch.Flush()
+}
+
+// headKeys is the Keys variant of listObjects. Keys that cannot be read are
+// logged and skipped.
+func (l *bucketLister) headKeys(ctx context.Context, keys []string) error {
+	objects := make([]object, 0, len(keys))
+	for _, key := range keys {
+		head, err := l.headObject(ctx, object{Key: key})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			l.logger.Warn("Failed to head object", "bucket", l.bucket, "key", key, "error", err)
+			continue
+		}
+		// HeadObject omits the storage class of STANDARD objects.
+		storageClass := string(head.StorageClass)
+		if storageClass == "" {
+			storageClass = string(types.StorageClassStandard)
+		}
+		objects = append(objects, object{
+			Key:          key,
+			LastModified: head.LastModified,
+			Size:         head.ContentLength,
+			ETag:         head.ETag,
+			StorageClass: storageClass,
+			head:         head,
+		})
+	}
+	l.sendObjects(ctx, objects)
+	return l.batch.Flush()
+}
+
+// inventoryManifest is the manifest.json of an S3 Inventory report.
+type inventoryManifest struct {
+	SourceBucket string `json:"sourceBucket"`
+	FileFormat   string `json:"fileFormat"`
+	// FileSchema lists the CSV columns, comma separated.
+	FileSchema string `json:"fileSchema"`
+	Files      []struct {
+		Key string `json:"key"`
+	} `json:"files"`
+	// bucket holds the manifest and the data files.
+	bucket string
+}
+
+// Inventory file formats read by listInventory. ORC is not supported.
+const (
+	inventoryCSV     = "CSV"
+	inventoryParquet = "Parquet"
+)
+
+// inventoryPageSize is the number of inventory rows sent to sendObjects at
+// once, the equivalent of a listing page.
+const inventoryPageSize = 1000
+
+// inventoryRow is an inventory report entry. The parquet tags are the
+// column names of Parquet reports; CSV columns are mapped by name.
+type inventoryRow struct {
+	Key              string    `parquet:"key"`
+	VersionID        string    `parquet:"version_id,optional"`
+	IsLatest         *bool     `parquet:"is_latest,optional"`
+	IsDeleteMarker   bool      `parquet:"is_delete_marker,optional"`
+	Size             *int64    `parquet:"size,optional"`
+	LastModifiedDate time.Time `parquet:"last_modified_date,optional,timestamp(millisecond)"`
+	ETag             string    `parquet:"e_tag,optional"`
+	StorageClass     string    `parquet:"storage_class,optional"`
+}
+
+// parseS3URI splits an s3://bucket/key URI.
+func parseS3URI(uri string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(uri, "s3://")
+	bucket, key, _ = strings.Cut(rest, "/")
+	if !ok || bucket == "" || key == "" {
+		return "", "", fmt.Errorf("%q is not an s3://bucket/key URI", uri)
+	}
+	return bucket, key, nil
+}
+
+// readManifest reads the inventory manifest of opts.
+func (a *account) readManifest(ctx context.Context, opts Options) (*inventoryManifest, error) {
+	bucket, key, err := parseS3URI(opts.InventoryManifest)
+	if err != nil {
+		return nil, err
+	}
+	client, _ := a.clientForBucket(ctx, bucket)
+	params := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
+	if opts.RequesterPays {
+		params.RequestPayer = types.RequestPayerRequester
+	}
+	out, err := client.GetObject(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	var m inventoryManifest
+	if err := json.NewDecoder(out.Body).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode inventory manifest: %w", err)
+	}
+	if m.FileFormat != inventoryCSV && m.FileFormat != inventoryParquet {
+		return nil, fmt.Errorf("unsupported inventory format %q", m.FileFormat)
+	}
+	if m.SourceBucket == "" {
+		return nil, errors.New("inventory manifest has no sourceBucket")
+	}
+	m.bucket = bucket
+	return &m, nil
+}
+
+// listInventory is the InventoryManifest variant of listObjects. It reads
+// the data files of m with client, which can be in another region than the
+// source bucket.
+func (l *bucketLister) listInventory(ctx context.Context, m *inventoryManifest, client s3API) error {
+	for _, f := range m.Files {
+		out, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: &m.bucket, Key: &f.Key, RequestPayer: l.requestPayer()})
+		if err != nil {
+			return fmt.Errorf("failed to get inventory file %s: %w", f.Key, err)
+		}
+		if m.FileFormat == inventoryParquet {
+			err = l.readInventoryParquet(ctx, out.Body)
+		} else {
+			err = l.readInventoryCSV(ctx, out.Body, m.FileSchema)
+		}
+		out.Body.Close()
+		if err != nil {
+			return fmt.Errorf("inventory file %s: %w", f.Key, err)
+		}
+		if l.full() {
+			l.logger.Info("Reached max_objects_per_bucket", "bucket", l.bucket, "objects", l.summary.Objects)
+			break
+		}
+	}
+	return l.batch.Flush()
+}
+
+// readInventoryCSV sends the rows of a gzipped CSV inventory file whose
+// columns are named by schema. CSV reports URL-encode the keys.
+func (l *bucketLister) readInventoryCSV(ctx context.Context, body io.Reader, schema string) error {
+	gz, err := gzip.NewReader(body)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	columns := map[string]int{}
+	for i, name := range strings.Split(schema, ",") {
+		columns[strings.TrimSpace(name)] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	r := csv.NewReader(gz)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	rows := make([]inventoryRow, 0, inventoryPageSize)
+	for {
+		record, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		key, err := url.QueryUnescape(field(record, "Key"))
+		if err != nil {
+			return fmt.Errorf("invalid key %q: %w", field(record, "Key"), err)
+		}
+		row := inventoryRow{
+			Key:            key,
+			VersionID:      field(record, "VersionId"),
+			IsDeleteMarker: field(record, "IsDeleteMarker") == "true",
+			ETag:           field(record, "ETag"),
+			StorageClass:   field(record, "StorageClass"),
+		}
+		if v := field(record, "IsLatest"); v != "" {
+			row.IsLatest = aws.Bool(v == "true")
+		}
+		if size, err := strconv.ParseInt(field(record, "Size"), 10, 64); err == nil {
+			row.Size = &size
+		}
+		if t, err := time.Parse(time.RFC3339, field(record, "LastModifiedDate")); err == nil {
+			row.LastModifiedDate = t
+		}
+		rows = append(rows, row)
+		if len(rows) == inventoryPageSize {
+			if err := l.sendInventory(ctx, rows); err != nil {
+				return err
+			}
+			if l.full() {
+				return nil
+			}
+			rows = rows[:0]
+		}
+	}
+	return l.sendInventory(ctx, rows)
+}
+
+// readInventoryParquet sends the rows of a Parquet inventory file. Parquet
+// needs random access, so the file is first copied to a temporary file.
+func (l *bucketLister) readInventoryParquet(ctx context.Context, body io.Reader) error {
+	tmp, err := os.CreateTemp("", "c1-s3-inventory-*.parquet")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, body)
+	if err != nil {
+		return err
+	}
+
+	f, err := parquet.OpenFile(tmp, size)
+	if err != nil {
+		return err
+	}
+	r := parquet.NewGenericReader[inventoryRow](f)
+	defer r.Close()
+	rows := make([]inventoryRow, inventoryPageSize)
+	for {
+		n, err := r.Read(rows)
+		if n > 0 {
+			if err := l.sendInventory(ctx, rows[:n]); err != nil {
+				return err
+			}
+			if l.full() {
+				return nil
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sendInventory sends inventory rows as one page of objects. Rows outside
+// Prefix are skipped, as are noncurrent versions and delete markers unless
+// IncludeVersions is set.
+func (l *bucketLister) sendInventory(ctx context.Context, rows []inventoryRow) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	objects := make([]object, 0, len(rows))
+	for _, row := range rows {
+		if !strings.HasPrefix(row.Key, l.opts.Prefix) {
+			continue
+		}
+		if !l.opts.IncludeVersions && (row.IsDeleteMarker || (row.IsLatest != nil && !*row.IsLatest)) {
+			continue
+		}
+		obj := object{
+			Key:          row.Key,
+			Size:         row.Size,
+			StorageClass: row.StorageClass,
+			DeleteMarker: row.IsDeleteMarker,
+			decoded:      true,
+		}
+		if row.ETag != "" {
+			obj.ETag = aws.String(row.ETag)
+		}
+		if !row.LastModifiedDate.IsZero() {
+			obj.LastModified = aws.Time(row.LastModifiedDate.UTC())
+		}
+		if l.opts.IncludeVersions {
+			obj.VersionID = row.VersionID
+			obj.IsLatest = row.IsLatest == nil || *row.IsLatest
+		}
+		objects = append(objects, obj)
+	}
+	l.sendObjects(ctx, objects)
+	return l.batch.EndPage()
+}
+
+// requestPayer returns the RequestPayer value to set on object requests.
+func (l *bucketLister) requestPayer() types.RequestPayer {
+	if l.opts.RequesterPays {
+		return types.RequestPayerRequester
+	}
+	return ""
+}
+
+// object is the subset of an S3 listing entry, current object or version,
+// that is turned into a DataObject.
+type object struct {
+	Key          string
+	LastModified *time.Time
+	Size         *int64
+	ETag         *string
+	StorageClass string
+	VersionID    string
+	DeleteMarker bool
+	// IsLatest reports whether the version is the current one. It is only
+	// set when listing versions.
+	IsLatest  bool
+	Owner     *types.Owner
+	Checksums []types.ChecksumAlgorithm
+	// head is the HeadObject response the object was read from, if any.
+	head *s3.HeadObjectOutput
+	// decoded reports whether Key is already URL-decoded, as the keys of
+	// inventory reports are, so that DecodeKeys leaves it alone.
+	decoded bool
+}
+
+// sendObjects filters objects, converts them to DataObjects and adds them to
+// the batch. The per-object tag and HeadObject requests run on a pool of
+// EnrichConcurrency workers once the page is filtered.
+func (l *bucketLister) sendObjects(ctx context.Context, objects []object) {
+	opts := l.opts
+	l.batch.Grow(len(objects))
+	items := make([]*pendingObject, 0, len(objects))
+	for _, obj := range objects {
+		if l.full() {
+			break
+		}
+		// Keys are at least one character long, so an empty key comes
+		// from an entry listed without one.
+		if obj.Key == "" {
+			continue
+		}
+		l.listed = max(l.listed, obj.Key)
+		if !matchSuffix(obj.Key, opts.Suffixes) || !matchPatterns(obj.Key, opts.Include, opts.Exclude) {
+			continue
+		}
+		if obj.LastModified != nil && obj.LastModified.Before(opts.modifiedSince) {
+			continue
+		}
+		if opts.SkipFolders && strings.HasSuffix(obj.Key, "/") && aws.ToInt64(obj.Size) == 0 {
+			continue
+		}
+		if size := aws.ToInt64(obj.Size); size < opts.MinObjectSizeBytes || (opts.MaxObjectSizeBytes > 0 && size > opts.MaxObjectSizeBytes) {
+			continue
+		}
+		name := obj.Key
+		if !obj.decoded {
+			name = l.decodeKey(name)
+		}
+		arn := arnForObject(l.partition, l.bucket, name)
+		if obj.VersionID != "" {
+			arn += "?versionId=" + obj.VersionID
+		}
+		remoteID, uri := l.identifiers(name, obj.VersionID, arn)
+		if !opts.dedup.add(remoteID) {
+			continue
+		}
+		lastModified := ""
+		if obj.LastModified != nil {
+			lastModified = formatTime(*obj.LastModified, opts.TimeFormat)
+		}
+		size := ""
+		if obj.Size != nil {
+			size = strconv.FormatInt(*obj.Size, 10)
+		}
+		// S3 wraps ETags in double quotes. Multipart uploads produce a
+		// composite "<md5>-<parts>" value that is not the object's MD5.
+		etag := ""
+		if obj.ETag != nil {
+			etag = strings.Trim(*obj.ETag, `"`)
+		}
 
-	connector := &S3Connector{
-		logger: logger,
+		metadata := map[string]string{
+			"last_modified": lastModified,
+			"size":          size,
+			"storage_class": obj.StorageClass,
+			"etag":          etag,
+		}
+		if len(obj.Checksums) > 0 {
+			algorithms := make([]string, len(obj.Checksums))
+			for i, a := range obj.Checksums {
+				algorithms[i] = string(a)
+			}
+			metadata["checksum_algorithm"] = strings.Join(algorithms, ",")
+		}
+		if opts.IncludeVersions {
+			metadata["version_id"] = obj.VersionID
+			metadata["is_delete_marker"] = strconv.FormatBool(obj.DeleteMarker)
+			metadata["is_latest"] = strconv.FormatBool(obj.IsLatest)
+		}
+		if opts.FetchTieringStatus {
+			metadata["intelligent_tiering_status"] = ""
+		}
+		if opts.FetchOwner && obj.Owner != nil {
+			if obj.Owner.ID != nil {
+				metadata["owner_id"] = *obj.Owner.ID
+			}
+			if obj.Owner.DisplayName != nil {
+				metadata["owner_display_name"] = *obj.Owner.DisplayName
+			}
+		}
+
+		l.summary.Objects++
+		l.summary.Bytes += aws.ToInt64(obj.Size)
+		items = append(items, &pendingObject{
+			obj: obj,
+			DataObject: &proto.DataObject{
+				RemoteId:     remoteID,
+				ResourceName: name,
+				Uri:          uri,
+				Metadata:     metadata,
+			}})
+	}
+
+	l.enrich(ctx, items)
+	for _, item := range items {
+		l.batch.add(item.DataObject)
+	}
+}
+
+// pendingObject is a DataObject waiting for the metadata of its tag and
+// HeadObject requests.
+type pendingObject struct {
+	*proto.DataObject
+	obj object
+}
+
+// enrichConcurrency is the default of Options.EnrichConcurrency.
+const enrichConcurrency = 8
+
+// enrich completes items on a bounded pool of workers. Each worker only
+// writes to the metadata of its own item.
+func (l *bucketLister) enrich(ctx context.Context, items []*pendingObject) {
+	workers := l.opts.EnrichConcurrency
+	if workers == 0 {
+		workers = enrichConcurrency
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for _, item := range items {
+		if !l.needsEnrich(item.obj) {
+			continue
+		}
+		if workers == 1 {
+			l.enrichObject(ctx, item)
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			l.enrichObject(ctx, item)
+		}()
+	}
+	wg.Wait()
+}
+
+// needsEnrich reports whether the options ask for per-object requests or a
+// presigned URL for obj.
+func (l *bucketLister) needsEnrich(obj object) bool {
+	if obj.DeleteMarker {
+		return false
+	}
+	return l.opts.FetchTags || l.presigner != nil || obj.head != nil || l.needsHead(obj) || l.needsParquetSchema(obj)
+}
+
+// needsParquetSchema reports whether the Parquet schema of obj should be
+// read. Archived objects cannot be read without a restore.
+func (l *bucketLister) needsParquetSchema(obj object) bool {
+	return l.opts.ExtractParquetSchema && isParquet(obj.Key) && !isArchived(obj.StorageClass)
+}
+
+// enrichObject adds the tags and HeadObject metadata of item and presigns
+// its URL. A single HeadObject request serves every head option, and is
+// reused when the object was read with HeadObject in the first place.
+func (l *bucketLister) enrichObject(ctx context.Context, item *pendingObject) {
+	obj := item.obj
+	if l.opts.FetchTags {
+		params := &s3.GetObjectTaggingInput{Bucket: &l.bucket, Key: &obj.Key, RequestPayer: l.requestPayer()}
+		if obj.VersionID != "" {
+			params.VersionId = &obj.VersionID
+		}
+		tags, err := l.client.GetObjectTagging(ctx, params)
+		if err != nil {
+			l.logger.Warn("Failed to get object tags", "bucket", l.bucket, "key", obj.Key, "error", err)
+		} else {
+			for _, tag := range tags.TagSet {
+				item.Metadata["tag:"+aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+			}
+		}
+	}
+
+	head := obj.head
+	if head == nil && l.needsHead(obj) {
+		var err error
+		head, err = l.headObject(ctx, obj)
+		if err != nil {
+			l.logger.Warn("Failed to head object", "bucket", l.bucket, "key", obj.Key, "error", err)
+		}
+	}
+	if head != nil {
+		l.addHeadMetadata(item.Metadata, obj, head)
+	}
+
+	if l.needsParquetSchema(obj) {
+		if err := l.addParquetSchema(ctx, item.Metadata, obj); err != nil {
+			l.logger.Warn("Failed to read Parquet schema", "bucket", l.bucket, "key", obj.Key, "error", err)
+		}
+	}
+
+	if l.presigner != nil {
+		params := &s3.GetObjectInput{Bucket: &l.bucket, Key: &obj.Key, RequestPayer: l.requestPayer()}
+		if obj.VersionID != "" {
+			params.VersionId = &obj.VersionID
+		}
+		req, err := l.presigner.PresignGetObject(ctx, params)
+		if err != nil {
+			l.logger.Warn("Failed to presign object URL", "bucket", l.bucket, "key", obj.Key, "error", err)
+		} else {
+			item.Uri = req.URL
+		}
 	}
-	var pluginMap = map[string]goplugin.Plugin{
-		"connector": &plugin.ConnectorGRPCPlugin{Impl: connector},
+}
+
+// full reports whether the bucket reached MaxObjectsPerBucket.
+func (l *bucketLister) full() bool {
+	return l.opts.MaxObjectsPerBucket > 0 && l.summary.Objects >= l.opts.MaxObjectsPerBucket
+}
+
+// needsHead reports whether the options ask for metadata of obj that only
+// HeadObject returns.
+func (l *bucketLister) needsHead(obj object) bool {
+	if obj.DeleteMarker {
+		return false
+	}
+	return l.opts.FetchEncryption || l.opts.FetchContentType ||
+		(l.opts.CheckRestoreStatus && isArchived(obj.StorageClass)) ||
+		(l.opts.FetchChecksum && len(obj.Checksums) > 0) ||
+		(l.opts.FetchTieringStatus && isIntelligentTiering(obj.StorageClass))
+}
+
+func (l *bucketLister) headObject(ctx context.Context, obj object) (*s3.HeadObjectOutput, error) {
+	params := &s3.HeadObjectInput{Bucket: &l.bucket, Key: &obj.Key, RequestPayer: l.requestPayer()}
+	if obj.VersionID != "" {
+		params.VersionId = &obj.VersionID
+	}
+	if l.opts.FetchChecksum {
+		params.ChecksumMode = types.ChecksumModeEnabled
+	}
+	return l.client.HeadObject(ctx, params)
+}
+
+// addHeadMetadata adds the HeadObject fields requested by the options to
+// metadata.
+func (l *bucketLister) addHeadMetadata(metadata map[string]string, obj object, head *s3.HeadObjectOutput) {
+	if l.opts.CheckRestoreStatus && isArchived(obj.StorageClass) {
+		status, expiry := restoreStatus(aws.ToString(head.Restore))
+		metadata["restore_status"] = status
+		metadata["restore_expiry"] = ""
+		if !expiry.IsZero() {
+			metadata["restore_expiry"] = formatTime(expiry, l.opts.TimeFormat)
+		}
+	}
+	if l.opts.FetchEncryption {
+		metadata["sse_algorithm"] = "none"
+		if head.ServerSideEncryption != "" {
+			metadata["sse_algorithm"] = string(head.ServerSideEncryption)
+		}
+		metadata["kms_key_id"] = "none"
+		if head.SSEKMSKeyId != nil {
+			metadata["kms_key_id"] = *head.SSEKMSKeyId
+		}
+	}
+	if l.opts.FetchTieringStatus && isIntelligentTiering(obj.StorageClass) {
+		metadata["intelligent_tiering_status"] = string(head.ArchiveStatus)
+	}
+	if l.opts.FetchContentType {
+		metadata["content_type"] = aws.ToString(head.ContentType)
+	}
+	if l.opts.FetchChecksum {
+		for key, value := range map[string]*string{
+			"checksum_crc32":     head.ChecksumCRC32,
+			"checksum_crc32c":    head.ChecksumCRC32C,
+			"checksum_crc64nvme": head.ChecksumCRC64NVME,
+			"checksum_sha1":      head.ChecksumSHA1,
+			"checksum_sha256":    head.ChecksumSHA256,
+		} {
+			if value != nil {
+				metadata[key] = *value
+			}
+		}
+	}
+}
+
+// isParquet reports whether key names a Parquet file.
+func isParquet(key string) bool {
+	return strings.HasSuffix(strings.ToLower(key), ".parquet")
+}
+
+// addParquetSchema adds the row count and leaf column types of a Parquet
+// object to metadata.
+func (l *bucketLister) addParquetSchema(ctx context.Context, metadata map[string]string, obj object) error {
+	if obj.Size == nil {
+		return errors.New("object size is unknown")
+	}
+	r := &rangeReader{ctx: ctx, l: l, obj: obj, size: *obj.Size}
+	f, err := parquet.OpenFile(r, r.size, parquet.SkipPageIndex(true), parquet.SkipBloomFilters(true))
+	if err != nil {
+		return err
+	}
+	metadata["num_rows"] = strconv.FormatInt(f.NumRows(), 10)
+	schema := f.Schema()
+	for _, path := range schema.Columns() {
+		leaf, _ := schema.Lookup(path...)
+		metadata["column:"+strings.Join(path, ".")] = leaf.Node.Type().String()
+	}
+	return nil
+}
+
+// parquetTailSize is how much of the end of a Parquet object rangeReader
+// fetches on its first read, enough for the footer of most files.
+const parquetTailSize = 64 << 10
+
+// rangeReader is an io.ReaderAt over an object. The last parquetTailSize
+// bytes are fetched with one ranged GetObject and other reads with one
+// request each. Requests are conditional on the listed ETag so that every
+// read sees the same object.
+type rangeReader struct {
+	ctx        context.Context
+	l          *bucketLister
+	obj        object
+	size       int64
+	tail       []byte
+	tailOffset int64
+}
+
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 || off >= r.size {
+		return 0, io.EOF
+	}
+	if r.tail == nil {
+		r.tailOffset = max(0, r.size-parquetTailSize)
+		tail, err := r.get(r.tailOffset, r.size-r.tailOffset)
+		if err != nil {
+			return 0, err
+		}
+		r.tail = tail
+	}
+	var b []byte
+	if off >= r.tailOffset {
+		b = r.tail[off-r.tailOffset:]
+	} else {
+		var err error
+		b, err = r.get(off, min(int64(len(p)), r.size-off))
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, b)
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// get returns n bytes of the object from off.
+func (r *rangeReader) get(off, n int64) ([]byte, error) {
+	params := &s3.GetObjectInput{
+		Bucket:       &r.l.bucket,
+		Key:          &r.obj.Key,
+		Range:        aws.String(fmt.Sprintf("bytes=%d-%d", off, off+n-1)),
+		IfMatch:      r.obj.ETag,
+		RequestPayer: r.l.requestPayer(),
+	}
+	if r.obj.VersionID != "" {
+		params.VersionId = &r.obj.VersionID
+	}
+	out, err := r.l.client.GetObject(r.ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(io.LimitReader(out.Body, n))
+}
+
+// isArchived reports whether objects of the storage class must be restored
+// before they can be read.
+func isArchived(storageClass string) bool {
+	switch types.ObjectStorageClass(storageClass) {
+	case types.ObjectStorageClassGlacier, types.ObjectStorageClassDeepArchive:
+		return true
+	}
+	return false
+}
+
+func isIntelligentTiering(storageClass string) bool {
+	return types.ObjectStorageClass(storageClass) == types.ObjectStorageClassIntelligentTiering
+}
+
+// restoreStatus parses the x-amz-restore header, such as
+//
+//	ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"
+//
+// into none, in-progress or restored and the expiry of the restored copy.
+func restoreStatus(restore string) (string, time.Time) {
+	if restore == "" {
+		return "none", time.Time{}
+	}
+	if strings.Contains(restore, `ongoing-request="true"`) {
+		return "in-progress", time.Time{}
+	}
+	var expiry time.Time
+	if _, date, ok := strings.Cut(restore, `expiry-date="`); ok {
+		date, _, _ = strings.Cut(date, `"`)
+		expiry, _ = time.Parse(http.TimeFormat, date)
+	}
+	return "restored", expiry
+}
+
+// sendPrefixes adds a DataObject per common prefix to the batch. The object
+// filters do not apply to prefixes.
+func (l *bucketLister) sendPrefixes(prefixes []types.CommonPrefix) {
+	for _, p := range prefixes {
+		if l.full() {
+			return
+		}
+		prefix := aws.ToString(p.Prefix)
+		l.listed = max(l.listed, prefix)
+		prefix = l.decodeKey(prefix)
+		remoteID, uri := l.identifiers(prefix, "", arnForObject(l.partition, l.bucket, prefix))
+		if !l.opts.dedup.add(remoteID) {
+			continue
+		}
+		l.summary.Objects++
+		l.batch.add(&proto.DataObject{
+			RemoteId:     remoteID,
+			ResourceName: prefix,
+			Uri:          uri,
+			Metadata: map[string]string{
+				"is_prefix": "true",
+			}})
+	}
+}
+
+// decodeKey returns key URL-decoded when DecodeKeys is set, or key itself
+// when it does not decode.
+func (l *bucketLister) decodeKey(key string) string {
+	if !l.opts.DecodeKeys {
+		return key
+	}
+	decoded, err := url.QueryUnescape(key)
+	if err != nil {
+		l.logger.Warn("Failed to decode key", "bucket", l.bucket, "key", key, "error", err)
+		return key
+	}
+	return decoded
+}
+
+// objectFields are the fields available to remote_id_template and
+// uri_template.
+type objectFields struct {
+	Bucket    string
+	Key       string
+	Region    string
+	VersionId string
+}
+
+// parseTemplate parses the template of the named option, nil when text is
+// empty. The template is executed once so that unknown fields fail here
+// rather than on every object.
+func parseTemplate(name, text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	t, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err == nil {
+		err = t.Execute(io.Discard, objectFields{})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return t, nil
+}
+
+// identifiers returns the RemoteId and Uri of key from the templates, arn
+// for the options without one.
+func (l *bucketLister) identifiers(key, versionID, arn string) (remoteID, uri string) {
+	fields := objectFields{Bucket: l.bucket, Key: key, Region: l.region, VersionId: versionID}
+	render := func(t *template.Template) string {
+		if t == nil {
+			return arn
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, fields); err != nil {
+			l.logger.Warn("Failed to execute template", "template", t.Name(), "key", key, "error", err)
+			return arn
+		}
+		return b.String()
+	}
+	return render(l.opts.remoteIDTemplate), render(l.opts.uriTemplate)
+}
+
+// dedupSet records the RemoteIds emitted during a sync. It is shared by the
+// bucket workers; a nil set records nothing.
+type dedupSet struct {
+	mu   sync.Mutex
+	seen map[string]struct{}
+}
+
+// add records id and reports whether it was new.
+func (d *dedupSet) add(id string) bool {
+	if d == nil {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.seen[id]; ok {
+		return false
+	}
+	d.seen[id] = struct{}{}
+	return true
+}
+
+// batcher is the pluginserve.Batcher of a bucket listing. It applies
+// Options.MetadataFields to each added object and keeps the callback for
+// the batchers of the shards.
+type batcher struct {
+	*pluginserve.Batcher
+	cb     plugin.CallbackHandler
+	fields []string
+}
+
+// callbackRetries is the default of Options.CallbackRetries.
+const callbackRetries = 3
+
+func newBatcher(ctx context.Context, cb plugin.CallbackHandler, opts Options) *batcher {
+	b := &batcher{Batcher: pluginserve.NewBatcher(ctx, cb, opts.BatchSize), cb: cb, fields: opts.MetadataFields}
+	b.Retries = opts.CallbackRetries
+	return b
+}
+
+// add adds obj to the batch. A failed send is kept in Err.
+func (b *batcher) add(obj *proto.DataObject) {
+	if len(b.fields) > 0 {
+		maps.DeleteFunc(obj.Metadata, func(key, _ string) bool {
+			return !matchField(key, b.fields)
+		})
+	}
+	_ = b.Add(obj)
+}
+
+// matchField reports whether a metadata key is kept by the metadata_fields
+// entries.
+func matchField(key string, fields []string) bool {
+	for _, field := range fields {
+		if prefix, ok := strings.CutSuffix(field, "*"); (ok && strings.HasPrefix(key, prefix)) || key == field {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionForRegion returns the AWS partition a region belongs to.
+func partitionForRegion(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	}
+	return "aws"
+}
+
+// arnForObject returns the ARN of an object in the given partition.
+func arnForObject(partition, bucket, key string) string {
+	return "arn:" + partition + ":s3:::" + bucket + "/" + key
+}
+
+// formatTime formats t with layout, which defaults to RFC3339. The "unix"
+// layout formats t as epoch seconds.
+func formatTime(t time.Time, layout string) string {
+	switch layout {
+	case "":
+		return t.Format(time.RFC3339)
+	case "unix":
+		return strconv.FormatInt(t.Unix(), 10)
+	}
+	return t.Format(layout)
+}
+
+// matchSuffix reports whether key ends with one of suffixes, ignoring case.
+// An empty suffixes list matches every key.
+func matchSuffix(key string, suffixes []string) bool {
+	if len(suffixes) == 0 {
+		return true
+	}
+	key = strings.ToLower(key)
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(key, strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPatterns reports whether key matches one of include and none of
+// exclude. An empty include list matches every key. Patterns are expected
+// to have been validated beforehand.
+func matchPatterns(key string, include, exclude []string) bool {
+	for _, pattern := range exclude {
+		if ok, _ := path.Match(pattern, key); ok {
+			return false
+		}
+	}
+	if len(include) == 0 {
+		return true
+	}
+	for _, pattern := range include {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// presignedParam matches the credential-bearing query parameters of a
+// presigned URL.
+var presignedParam = regexp.MustCompile(`(?i)(X-Amz-(?:Signature|Credential|Security-Token)=)[^&\s"]+`)
+
+// redactor replaces registered secrets and presigned URL credentials with a
+// placeholder.
+type redactor struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+func (r *redactor) add(secrets ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, secret := range secrets {
+		if secret != "" && !slices.Contains(r.secrets, secret) {
+			r.secrets = append(r.secrets, secret)
+		}
+	}
+}
+
+func (r *redactor) redact(s string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, secret := range r.secrets {
+		s = strings.ReplaceAll(s, secret, "[REDACTED]")
+	}
+	return presignedParam.ReplaceAllString(s, "${1}[REDACTED]")
+}
+
+// redactingLogger is an hclog.Logger that redacts the message and the
+// string, error and fmt.Stringer arguments of every log line, including the
+// lines written through StandardLogger and StandardWriter.
+type redactingLogger struct {
+	hclog.Logger
+	r *redactor
+}
+
+func (l *redactingLogger) args(args []interface{}) []interface{} {
+	res := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case string:
+			res[i] = l.r.redact(v)
+		case error:
+			res[i] = l.r.redact(v.Error())
+		case fmt.Stringer:
+			res[i] = l.r.redact(v.String())
+		default:
+			res[i] = arg
+		}
+	}
+	return res
+}
+
+func (l *redactingLogger) Log(level hclog.Level, msg string, args ...interface{}) {
+	l.Logger.Log(level, l.r.redact(msg), l.args(args)...)
+}
+
+func (l *redactingLogger) Trace(msg string, args ...interface{}) {
+	l.Logger.Trace(l.r.redact(msg), l.args(args)...)
+}
+
+func (l *redactingLogger) Debug(msg string, args ...interface{}) {
+	l.Logger.Debug(l.r.redact(msg), l.args(args)...)
+}
+
+func (l *redactingLogger) Info(msg string, args ...interface{}) {
+	l.Logger.Info(l.r.redact(msg), l.args(args)...)
+}
+
+func (l *redactingLogger) Warn(msg string, args ...interface{}) {
+	l.Logger.Warn(l.r.redact(msg), l.args(args)...)
+}
+
+func (l *redactingLogger) Error(msg string, args ...interface{}) {
+	l.Logger.Error(l.r.redact(msg), l.args(args)...)
+}
+
+func (l *redactingLogger) With(args ...interface{}) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.With(l.args(args)...), r: l.r}
+}
+
+func (l *redactingLogger) Named(name string) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.Named(name), r: l.r}
+}
+
+func (l *redactingLogger) ResetNamed(name string) hclog.Logger {
+	return &redactingLogger{Logger: l.Logger.ResetNamed(name), r: l.r}
+}
+
+func (l *redactingLogger) StandardLogger(opts *hclog.StandardLoggerOptions) *log.Logger {
+	return log.New(l.StandardWriter(opts), "", 0)
+}
+
+func (l *redactingLogger) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+	return &redactingWriter{w: l.Logger.StandardWriter(opts), r: l.r}
+}
+
+// redactingWriter redacts each write before passing it to w.
+type redactingWriter struct {
+	w io.Writer
+	r *redactor
+}
+
+func (w *redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, w.r.redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// serveMetrics exposes the sync metrics for scraping at addr/metrics.
+func serveMetrics(logger hclog.Logger, addr string) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(objectsSynced, bucketsFailed, syncDuration)
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	logger.Info("Serving metrics", "addr", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error("Failed to serve metrics", "error", err)
+	}
+}
+
+func main() {
+	printSchema := flag.Bool("print-schema", false, "print the JSON schema of the sync options and exit")
+	describe := flag.Bool("describe", false, "same as -print-schema")
+	check := flag.String("test", "", "check that the given sync options can reach S3 and exit")
+	flag.Parse()
+	if *printSchema || *describe {
+		schema, err := (&S3Connector{}).Describe()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "failed to generate options schema:", err)
+			os.Exit(1)
+		}
+		fmt.Println(schema)
+		return
+	}
+
+	redactor := &redactor{}
+	logger := &redactingLogger{Logger: pluginserve.NewLogger(), r: redactor}
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	if *check != "" {
+		if err := (&S3Connector{logger: logger, redactor: redactor, ctx: ctx}).Check(*check); err != nil {
+			logger.Error("Connection check failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	flush := pluginserve.Tracing(ctx, logger, "c1-s3")
+	defer flush()
+
+	if addr := os.Getenv("C1_S3_METRICS_ADDR"); addr != "" {
+		go serveMetrics(logger, addr)
 	}
 
-	goplugin.Serve(&goplugin.ServeConfig{
-		HandshakeConfig: handshakeConfig,
-		Plugins:         pluginMap,
-		GRPCServer:      goplugin.DefaultGRPCServer,
+	pluginserve.Serve(logger, &S3Connector{
+		logger:   logger,
+		redactor: redactor,
+		ctx:      ctx,
 	})
 }
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"os/exec"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/plugintest"
+)
+
+// fakeS3 is an s3API serving the listings of in-memory buckets. Methods it
+// does not implement panic through the nil embedded interface.
+type fakeS3 struct {
+	s3API
+	// objects maps bucket names to their objects, sorted by key.
+	objects map[string][]types.Object
+}
+
+func (f *fakeS3) GetBucketLocation(ctx context.Context, in *s3.GetBucketLocationInput, _ ...func(*s3.Options)) (*s3.GetBucketLocationOutput, error) {
+	return &s3.GetBucketLocationOutput{}, nil
+}
+
+// ListObjectsV2 honours Prefix, StartAfter, ContinuationToken and MaxKeys.
+// The continuation token is the last key of the previous page.
+func (f *fakeS3) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	start := aws.ToString(in.StartAfter)
+	if in.ContinuationToken != nil {
+		start = *in.ContinuationToken
+	}
+	maxKeys := int(aws.ToInt32(in.MaxKeys))
+	if maxKeys == 0 {
+		maxKeys = 1000
+	}
+	out := &s3.ListObjectsV2Output{}
+	for _, obj := range f.objects[aws.ToString(in.Bucket)] {
+		key := aws.ToString(obj.Key)
+		if obj.Key != nil && (key <= start || !strings.HasPrefix(key, aws.ToString(in.Prefix))) {
+			continue
+		}
+		if len(out.Contents) == maxKeys {
+			out.IsTruncated = aws.Bool(true)
+			out.NextContinuationToken = out.Contents[maxKeys-1].Key
+			break
+		}
+		out.Contents = append(out.Contents, obj)
+	}
+	return out, nil
+}
+
+// newTestConnector returns a connector and an account whose clients are
+// all client.
+func newTestConnector(client s3API) (*S3Connector, *account) {
+	logger := hclog.NewNullLogger()
+	return &S3Connector{logger: logger}, &account{
+		logger:    logger,
+		client:    client,
+		region:    "us-east-1",
+		newClient: func(string) s3API { return client },
+		regions:   map[string]string{},
+		clients:   map[string]s3API{"us-east-1": client},
+		created:   map[string]time.Time{},
+	}
+}
+
+// lockedRecorder returns a Recorder and the handler the connector would
+// wrap it in.
+func lockedRecorder() (*plugintest.Recorder, *lockedCallbackHandler) {
+	rec := &plugintest.Recorder{}
+	return rec, &lockedCallbackHandler{cb: rec}
+}
+
+func TestListObjectsPages(t *testing.T) {
+	var objects []types.Object
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		objects = append(objects, types.Object{Key: aws.String(key), Size: aws.Int64(10)})
+	}
+	s, a := newTestConnector(&fakeS3{objects: map[string][]types.Object{"bucket": objects}})
+	rec, cb := lockedRecorder()
+
+	summary, err := s.listObjects(context.Background(), a, "bucket", Options{MaxKeys: 2}, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bucketSummary{Objects: 5, Bytes: 50, Pages: 3, LastKey: "e"}
+	if summary != want {
+		t.Errorf("summary = %+v, want %+v", summary, want)
+	}
+	if got := len(rec.Objects()); got != 5 {
+		t.Errorf("got %d objects, want 5", got)
+	}
+}
+
+// checkObjects compares the identifiers and metadata of DataObjects.
+func checkObjects(t *testing.T, got []*proto.DataObject, want []*proto.DataObject) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d objects, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.RemoteId != w.RemoteId || g.ResourceName != w.ResourceName || g.Uri != w.Uri || !maps.Equal(g.Metadata, w.Metadata) {
+			t.Errorf("object %d = %v, want %v", i, g, w)
+		}
+	}
+}
+
+func TestListObjectsDataObjects(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	client := &fakeS3{objects: map[string][]types.Object{"bucket": {
+		{Key: aws.String("data/a.csv"), Size: aws.Int64(3), LastModified: &modified, ETag: aws.String(`"abc"`), StorageClass: types.ObjectStorageClassStandard},
+		{Key: aws.String("data/b.json"), Size: aws.Int64(0), LastModified: &modified, ETag: aws.String(`"d41d-2"`), StorageClass: types.ObjectStorageClassGlacier},
+	}}}
+	s, a := newTestConnector(client)
+	rec, cb := lockedRecorder()
+
+	if _, err := s.listObjects(context.Background(), a, "bucket", Options{}, cb); err != nil {
+		t.Fatal(err)
+	}
+	checkObjects(t, rec.Objects(), []*proto.DataObject{
+		{
+			RemoteId:     "arn:aws:s3:::bucket/data/a.csv",
+			ResourceName: "data/a.csv",
+			Uri:          "arn:aws:s3:::bucket/data/a.csv",
+			Metadata: map[string]string{
+				"last_modified": "2024-05-01T12:00:00Z",
+				"size":          "3",
+				"storage_class": "STANDARD",
+				"etag":          "abc",
+			},
+		},
+		{
+			RemoteId:     "arn:aws:s3:::bucket/data/b.json",
+			ResourceName: "data/b.json",
+			Uri:          "arn:aws:s3:::bucket/data/b.json",
+			Metadata: map[string]string{
+				"last_modified": "2024-05-01T12:00:00Z",
+				"size":          "0",
+				"storage_class": "GLACIER",
+				"etag":          "d41d-2",
+			},
+		},
+	})
+}
+
+func TestListObjectsNilKey(t *testing.T) {
+	client := &fakeS3{objects: map[string][]types.Object{"bucket": {{Key: nil, Size: aws.Int64(1)}, {Key: aws.String("a"), Size: aws.Int64(1)}}}}
+	s, a := newTestConnector(client)
+	rec, cb := lockedRecorder()
+
+	summary, err := s.listObjects(context.Background(), a, "bucket", Options{}, cb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := rec.Objects()
+	if len(objects) != 1 || objects[0].ResourceName != "a" || summary.Objects != 1 {
+		t.Errorf("got %v (summary %+v), want only a", objects, summary)
+	}
+}
+
+func TestListObjectsRetriesCallback(t *testing.T) {
+	client := &fakeS3{objects: map[string][]types.Object{"bucket": {{Key: aws.String("a")}}}}
+	s, a := newTestConnector(client)
+	rec, cb := lockedRecorder()
+	rec.Err = plugintest.FailFirst(2, errors.New("host unavailable"))
+
+	if _, err := s.listObjects(context.Background(), a, "bucket", Options{CallbackRetries: 2}, cb); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.Calls(); got != 3 {
+		t.Errorf("got %d callbacks, want 3", got)
+	}
+	if got := len(rec.Objects()); got != 1 {
+		t.Errorf("got %d objects, want 1", got)
+	}
+}
+
+func TestSyncBucketsCallbackFailure(t *testing.T) {
+	for _, retries := range []int{0, 1} {
+		client := &fakeS3{objects: map[string][]types.Object{"bucket": {{Key: aws.String("a")}}}}
+		s, a := newTestConnector(client)
+		rec, cb := lockedRecorder()
+		rec.Err = plugintest.FailFirst(10, errors.New("host unavailable"))
+		res := &syncResult{skipped: map[string]string{}}
+
+		err := s.syncBuckets(context.Background(), a, bucketSlice([]string{"bucket"}), Options{CallbackRetries: retries}, cb, res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.failed) != 1 || res.failed[0] != "bucket" || len(res.errs) != 1 {
+			t.Errorf("retries %d: failed = %v, errs = %v, want the bucket to fail", retries, res.failed, res.errs)
+		}
+		if got := rec.Calls(); got != retries+1 {
+			t.Errorf("retries %d: got %d callbacks, want %d", retries, got, retries+1)
+		}
+	}
+}
+
+func TestMatchSuffix(t *testing.T) {
+	tests := []struct {
+		key      string
+		suffixes []string
+		want     bool
+	}{
+		{"data/a.csv", nil, true},
+		{"data/a.csv", []string{".csv"}, true},
+		{"data/a.CSV", []string{".csv"}, true},
+		{"data/a.csv", []string{".CSV"}, true},
+		{"data/a.Csv", []string{"csv"}, true},
+		{"data/a.csv", []string{".json", ".CSV"}, true},
+		{"data/a.csv.gz", []string{".csv"}, false},
+		{"data/a.json", []string{".CSV"}, false},
+	}
+	for _, tt := range tests {
+		if got := matchSuffix(tt.key, tt.suffixes); got != tt.want {
+			t.Errorf("matchSuffix(%q, %q) = %v, want %v", tt.key, tt.suffixes, got, tt.want)
+		}
+	}
+}
+
+// concurrencyProbe is a fakeS3 recording the largest number of
+// ListObjectsV2 calls in flight at once.
+type concurrencyProbe struct {
+	*fakeS3
+	mu       sync.Mutex
+	inFlight int
+	max      int
+}
+
+func (p *concurrencyProbe) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	p.mu.Lock()
+	p.inFlight++
+	p.max = max(p.max, p.inFlight)
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.inFlight--
+		p.mu.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+	return p.fakeS3.ListObjectsV2(ctx, in, optFns...)
+}
+
+func TestSyncBucketsConcurrency(t *testing.T) {
+	const concurrency = 3
+	buckets := make([]string, 10)
+	objects := map[string][]types.Object{}
+	for i := range buckets {
+		buckets[i] = fmt.Sprintf("bucket-%d", i)
+		objects[buckets[i]] = []types.Object{{Key: aws.String("a")}}
+	}
+	client := &concurrencyProbe{fakeS3: &fakeS3{objects: objects}}
+	s, a := newTestConnector(client)
+	rec, cb := lockedRecorder()
+	res := &syncResult{skipped: map[string]string{}}
+
+	if err := s.syncBuckets(context.Background(), a, bucketSlice(buckets), Options{Concurrency: concurrency}, cb, res); err != nil {
+		t.Fatal(err)
+	}
+	if client.max > concurrency {
+		t.Errorf("%d listings ran at once, want at most %d", client.max, concurrency)
+	}
+	if got := len(rec.Objects()); got != len(buckets) || res.total.Objects != len(buckets) {
+		t.Errorf("got %d objects (total %d), want %d", got, res.total.Objects, len(buckets))
+	}
+}
+
+func TestSyncBucketsAccounts(t *testing.T) {
+	// Two syncs of one connector, each with its own account, run at once.
+	s, _ := newTestConnector(nil)
+	var wg sync.WaitGroup
+	recs := make([]*plugintest.Recorder, 2)
+	for i := range recs {
+		_, a := newTestConnector(&fakeS3{objects: map[string][]types.Object{
+			"bucket": {{Key: aws.String(fmt.Sprintf("key-%d", i))}},
+		}})
+		a.regions["bucket"] = fmt.Sprintf("region-%d", i)
+		rec, cb := lockedRecorder()
+		recs[i] = rec
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res := &syncResult{skipped: map[string]string{}}
+			if err := s.syncBuckets(context.Background(), a, bucketSlice([]string{"bucket"}), Options{IncludeBuckets: true}, cb, res); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for i, rec := range recs {
+		objects := rec.Objects()
+		if len(objects) != 2 || objects[0].Metadata["region"] != fmt.Sprintf("region-%d", i) || objects[1].ResourceName != fmt.Sprintf("key-%d", i) {
+			t.Errorf("sync %d sent %v, want its own bucket and key", i, objects)
+		}
+	}
+}
+
+func TestSyncBucketsDedup(t *testing.T) {
+	objects := map[string][]types.Object{
+		"logs":    {{Key: aws.String("2024/a.log")}, {Key: aws.String("2024/b.log")}},
+		"archive": {{Key: aws.String("2024/a.log")}},
+	}
+	tests := []struct {
+		name     string
+		buckets  []string
+		template string
+		want     []string
+	}{
+		{
+			name:    "bucket listed twice",
+			buckets: []string{"logs", "logs"},
+			want:    []string{"arn:aws:s3:::logs/2024/a.log", "arn:aws:s3:::logs/2024/b.log"},
+		},
+		{
+			name:     "same key in two buckets",
+			buckets:  []string{"logs", "archive"},
+			template: "{{.Key}}",
+			want:     []string{"2024/a.log", "2024/b.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, a := newTestConnector(&fakeS3{objects: objects})
+			rec, cb := lockedRecorder()
+			opts := Options{dedup: &dedupSet{seen: map[string]struct{}{}}}
+			opts.remoteIDTemplate, _ = parseTemplate("remote_id_template", tt.template)
+			res := &syncResult{skipped: map[string]string{}}
+
+			if err := s.syncBuckets(context.Background(), a, bucketSlice(tt.buckets), opts, cb, res); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, obj := range rec.Objects() {
+				got = append(got, obj.RemoteId)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sent %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProxyClient(t *testing.T) {
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy", "REQUEST_METHOD"} {
+		t.Setenv(key, "")
+	}
+	t.Setenv("HTTP_PROXY", "http://env-proxy:8080")
+
+	tr := proxyClient(Options{
+		HTTPSProxy: "http://proxy.example.com:3128",
+		NoProxy:    "minio.internal",
+	}).GetTransport()
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://bucket.s3.us-east-1.amazonaws.com/key", "http://proxy.example.com:3128"},
+		{"http://bucket.s3.us-east-1.amazonaws.com/key", "http://env-proxy:8080"},
+		{"https://minio.internal/bucket/key", ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u, err := tr.Proxy(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if u != nil {
+			got = u.String()
+		}
+		if got != tt.want {
+			t.Errorf("proxy for %s = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestValidateProxy(t *testing.T) {
+	for _, proxy := range []string{"proxy:3128", "://proxy", "http://"} {
+		err := Options{HTTPProxy: proxy}.validate()
+		if err == nil || !strings.Contains(err.Error(), "invalid http_proxy") {
+			t.Errorf("http_proxy %q: validate() = %v, want an invalid http_proxy error", proxy, err)
+		}
+	}
+	if err := (Options{HTTPSProxy: "http://proxy.example.com:3128"}).validate(); err != nil {
+		t.Errorf("validate() = %v", err)
+	}
+}
+
+// objectStore is a fakeS3 serving GetObject from in-memory files, keyed by
+// bucket/key, and recording the requests.
+type objectStore struct {
+	*fakeS3
+	files    map[string][]byte
+	mu       sync.Mutex
+	requests []*s3.GetObjectInput
+}
+
+func (o *objectStore) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	o.mu.Lock()
+	o.requests = append(o.requests, in)
+	o.mu.Unlock()
+	data, ok := o.files[aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(data)), ContentLength: aws.Int64(int64(len(data)))}, nil
+}
+
+func TestListInventory(t *testing.T) {
+	var csv bytes.Buffer
+	gz := gzip.NewWriter(&csv)
+	io.WriteString(gz, `"source","logs/a%2520b.log","10"`+"\n"+`"source","data/c.csv","20"`+"\n"+`"source","logs/d.log","30"`+"\n")
+	gz.Close()
+	client := &objectStore{fakeS3: &fakeS3{}, files: map[string][]byte{
+		"inventory/manifest.json": []byte(`{"sourceBucket": "source", "fileFormat": "CSV", "fileSchema": "Bucket, Key, Size", "files": [{"key": "data/1.csv.gz"}]}`),
+		"inventory/data/1.csv.gz": csv.Bytes(),
+	}}
+	s, a := newTestConnector(client)
+	rec, cb := lockedRecorder()
+	opts := Options{InventoryManifest: "s3://inventory/manifest.json", Prefix: "logs/", DecodeKeys: true, RequesterPays: true}
+
+	var err error
+	a.inventory, err = a.readManifest(context.Background(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.listObjects(context.Background(), a, "source", opts, cb); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, obj := range rec.Objects() {
+		got = append(got, obj.ResourceName)
+	}
+	if want := []string{"logs/a%20b.log", "logs/d.log"}; !slices.Equal(got, want) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+	for _, req := range client.requests {
+		if req.RequestPayer != types.RequestPayerRequester {
+			t.Errorf("GetObject %s without RequestPayer", aws.ToString(req.Key))
+		}
+	}
+}
+
+func TestArnForObject(t *testing.T) {
+	tests := []struct {
+		region string
+		want   string
+	}{
+		{"us-east-1", "arn:aws:s3:::bucket/dir/key.csv"},
+		{"eu-west-3", "arn:aws:s3:::bucket/dir/key.csv"},
+		{"cn-north-1", "arn:aws-cn:s3:::bucket/dir/key.csv"},
+		{"cn-northwest-1", "arn:aws-cn:s3:::bucket/dir/key.csv"},
+		{"us-gov-west-1", "arn:aws-us-gov:s3:::bucket/dir/key.csv"},
+	}
+	for _, tt := range tests {
+		if got := arnForObject(partitionForRegion(tt.region), "bucket", "dir/key.csv"); got != tt.want {
+			t.Errorf("region %s: arnForObject = %q, want %q", tt.region, got, tt.want)
+		}
+	}
+}
+
+func TestRedactingLogger(t *testing.T) {
+	const (
+		secretKey    = "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"
+		sessionToken = "FwoGZXIvYXdzEXAMPLETOKEN"
+		signature    = "fe5f80f77d5fa3beca038a248ff027d0445342fe2855ddc963176630326f1024"
+	)
+	var buf bytes.Buffer
+	r := &redactor{}
+	r.add(secretKey, sessionToken)
+	logger := &redactingLogger{Logger: hclog.New(&hclog.LoggerOptions{Output: &buf}), r: r}
+
+	presigned := "https://bucket.s3.amazonaws.com/key?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=" + signature
+	logger.With("token", sessionToken).Warn("Failed with "+secretKey,
+		"error", errors.New("invalid token "+sessionToken),
+		"uri", presigned)
+
+	out := buf.String()
+	for _, secret := range []string{secretKey, sessionToken, signature} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log contains %q: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "X-Amz-Signature=[REDACTED]") {
+		t.Errorf("log does not mask the signature: %s", out)
+	}
+
+	buf.Reset()
+	logger.StandardLogger(&hclog.StandardLoggerOptions{InferLevels: true}).Printf("[WARN] retrying with %s", secretKey)
+	out = buf.String()
+	if strings.Contains(out, secretKey) || !strings.Contains(out, "retrying with [REDACTED]") {
+		t.Errorf("standard logger output is not redacted: %s", out)
+	}
+}
+
+// jsonNames returns the json names of the exported fields of t, with the
+// fields of embedded structs inlined.
+func jsonNames(t reflect.Type) []string {
+	var names []string
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-":
+		case f.Anonymous && name == "":
+			names = append(names, jsonNames(f.Type)...)
+		case name == "":
+			names = append(names, f.Name)
+		default:
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func TestDescribe(t *testing.T) {
+	out, err := (&S3Connector{}).Describe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal([]byte(out), &schema); err != nil {
+		t.Fatal(err)
+	}
+	names := jsonNames(reflect.TypeOf(Options{}))
+	for _, name := range names {
+		if _, ok := schema.Properties[name]; !ok {
+			t.Errorf("schema has no property %q", name)
+		}
+	}
+	if len(schema.Properties) != len(names) {
+		t.Errorf("schema has %d properties, want %d", len(schema.Properties), len(names))
+	}
+	for _, name := range []string{"bucket_pattern", "profile", "credential_source", "callback_retries"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("options have no %q field", name)
+		}
+	}
+}
+
+func TestDescribeFlag(t *testing.T) {
+	// The test binary runs itself with -describe to go through main.
+	if os.Getenv("C1_S3_TEST_MAIN") == "1" {
+		os.Args = []string{"s3", "-describe"}
+		main()
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestDescribeFlag$")
+	cmd.Env = append(os.Environ(), "C1_S3_TEST_MAIN=1")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("-describe failed: %v", err)
+	}
+	var got, want interface{}
+	if err := json.NewDecoder(bytes.NewReader(out)).Decode(&got); err != nil {
+		t.Fatalf("-describe printed no JSON schema: %v\n%s", err, out)
+	}
+	schema, _ := (&S3Connector{}).Describe()
+	if err := json.Unmarshal([]byte(schema), &want); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("-describe printed %s, want the Describe schema", out)
+	}
+}
+
+// BenchmarkSendObjects converts a page of 1000 listed objects into a
+// per-page batch.
+func BenchmarkSendObjects(b *testing.B) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	objects := make([]object, 1000)
+	for i := range objects {
+		objects[i] = object{
+			Key:          fmt.Sprintf("data/%06d.csv", i),
+			LastModified: &modified,
+			Size:         aws.Int64(1024),
+			ETag:         aws.String(`"9e107d9d372bb6826bd81d3542a419d6"`),
+			StorageClass: "STANDARD",
+		}
+	}
+	ctx := context.Background()
+	l := &bucketLister{logger: hclog.NewNullLogger(), bucket: "bucket", partition: "aws"}
+	b.ReportAllocs()
+	for b.Loop() {
+		l.batch = newBatcher(ctx, discardCallbackHandler{}, Options{})
+		l.sendObjects(ctx, objects)
+		l.batch.EndPage()
+	}
+}
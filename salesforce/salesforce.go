@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+type SalesforceConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+	client *http.Client
+	// instanceURL is the org URL returned with the access token.
+	instanceURL string
+	opts        Options
+}
+
+type Options struct {
+	// ClientID and ClientSecret are the consumer key and secret of a
+	// connected app with the client credentials flow enabled.
+	// ClientSecret defaults to SALESFORCE_CLIENT_SECRET.
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// LoginURL is the org's My Domain URL, such as
+	// https://example.my.salesforce.com, which the client credentials
+	// flow requires. It defaults to https://login.salesforce.com, or
+	// https://test.salesforce.com when Sandbox is set.
+	LoginURL string `json:"login_url"`
+	Sandbox  bool   `json:"sandbox"`
+	// APIVersion is the REST API version, 62.0 by default.
+	APIVersion string `json:"api_version"`
+	// Objects restricts the catalog to these sObject API names.
+	Objects []string `json:"objects"`
+	// CountRecords adds record_count, from a SELECT COUNT() query, to
+	// each queryable sObject. DescribeFields adds name_field and
+	// external_id_fields from the sObject describe. Both cost one request
+	// per sObject.
+	CountRecords   bool `json:"count_records"`
+	DescribeFields bool `json:"describe_fields"`
+	TimeoutSeconds int  `json:"timeout_seconds"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+type sObject struct {
+	Name      string `json:"name"`
+	Label     string `json:"label"`
+	Custom    bool   `json:"custom"`
+	KeyPrefix string `json:"keyPrefix"`
+	Queryable bool   `json:"queryable"`
+}
+
+type field struct {
+	Name       string `json:"name"`
+	NameField  bool   `json:"nameField"`
+	ExternalID bool   `json:"externalId"`
+}
+
+func (s *SalesforceConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		s.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.ClientSecret == "" {
+		opts.ClientSecret = os.Getenv("SALESFORCE_CLIENT_SECRET")
+	}
+	if opts.ClientID == "" || opts.ClientSecret == "" {
+		return errors.New("invalid options: client_id and client_secret are required")
+	}
+	if opts.LoginURL == "" {
+		opts.LoginURL = "https://login.salesforce.com"
+		if opts.Sandbox {
+			opts.LoginURL = "https://test.salesforce.com"
+		}
+	}
+	opts.LoginURL = strings.TrimSuffix(opts.LoginURL, "/")
+	if opts.APIVersion == "" {
+		opts.APIVersion = "62.0"
+	}
+	opts.APIVersion = strings.TrimPrefix(opts.APIVersion, "v")
+	s.opts = opts
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if err := s.authenticate(ctx); err != nil {
+		s.logger.Error("Failed to authenticate", "error", err)
+		return fmt.Errorf("failed to authenticate: %w", err)
+	}
+
+	var global struct {
+		SObjects []sObject `json:"sobjects"`
+	}
+	if err := s.get(ctx, "/sobjects", &global); err != nil {
+		s.logger.Error("Failed to list sObjects", "error", err)
+		return fmt.Errorf("failed to list sObjects: %w", err)
+	}
+	objects := global.SObjects
+	if opts.Objects != nil {
+		objects = slices.DeleteFunc(objects, func(o sObject) bool {
+			return !slices.Contains(opts.Objects, o.Name)
+		})
+	}
+
+	var errs []error
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	for _, o := range objects {
+		metadata := map[string]string{
+			"label":      o.Label,
+			"custom":     strconv.FormatBool(o.Custom),
+			"key_prefix": o.KeyPrefix,
+			"queryable":  strconv.FormatBool(o.Queryable),
+		}
+		if opts.CountRecords && o.Queryable {
+			count, err := s.countRecords(ctx, o.Name)
+			if err != nil {
+				s.logger.Warn("Failed to count records", "sobject", o.Name, "error", err)
+				errs = append(errs, fmt.Errorf("sobject %s: %w", o.Name, err))
+			} else {
+				metadata["record_count"] = strconv.FormatInt(count, 10)
+			}
+		}
+		if opts.DescribeFields {
+			nameField, externalIDs, err := s.keyFields(ctx, o.Name)
+			if err != nil {
+				s.logger.Warn("Failed to describe sObject", "sobject", o.Name, "error", err)
+				errs = append(errs, fmt.Errorf("sobject %s: %w", o.Name, err))
+			} else {
+				metadata["name_field"] = nameField
+				metadata["external_id_fields"] = strings.Join(externalIDs, ",")
+			}
+		}
+
+		uri := s.instanceURL + "/lightning/setup/ObjectManager/" + url.PathEscape(o.Name) + "/Details/view"
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     uri,
+			ResourceName: o.Name,
+			Uri:          uri,
+			Metadata:     metadata})
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+	if err := batch.Flush(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// authenticate gets an access token with the client credentials flow and
+// sets up the client and instance URL used by the API requests.
+func (s *SalesforceConnector) authenticate(ctx context.Context) error {
+	timeout := 30 * time.Second
+	if s.opts.TimeoutSeconds > 0 {
+		timeout = time.Duration(s.opts.TimeoutSeconds) * time.Second
+	}
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, &http.Client{Timeout: timeout})
+
+	config := &clientcredentials.Config{
+		ClientID:     s.opts.ClientID,
+		ClientSecret: s.opts.ClientSecret,
+		TokenURL:     s.opts.LoginURL + "/services/oauth2/token",
+		AuthStyle:    oauth2.AuthStyleInParams,
+	}
+	token, err := config.Token(ctx)
+	if err != nil {
+		return err
+	}
+	instanceURL, _ := token.Extra("instance_url").(string)
+	if instanceURL == "" {
+		return errors.New("token response has no instance_url")
+	}
+	s.instanceURL = strings.TrimSuffix(instanceURL, "/")
+	s.client = oauth2.NewClient(ctx, oauth2.ReuseTokenSource(token, config.TokenSource(ctx)))
+	s.client.Timeout = timeout
+	return nil
+}
+
+// countRecords returns the number of records of an sObject.
+func (s *SalesforceConnector) countRecords(ctx context.Context, name string) (int64, error) {
+	var resp struct {
+		TotalSize int64 `json:"totalSize"`
+	}
+	q := url.QueryEscape("SELECT COUNT() FROM " + name)
+	if err := s.get(ctx, "/query?q="+q, &resp); err != nil {
+		return 0, err
+	}
+	return resp.TotalSize, nil
+}
+
+// keyFields returns the name field and the external ID fields of an
+// sObject.
+func (s *SalesforceConnector) keyFields(ctx context.Context, name string) (nameField string, externalIDs []string, err error) {
+	var resp struct {
+		Fields []field `json:"fields"`
+	}
+	if err := s.get(ctx, "/sobjects/"+url.PathEscape(name)+"/describe", &resp); err != nil {
+		return "", nil, err
+	}
+	for _, f := range resp.Fields {
+		if f.NameField {
+			nameField = f.Name
+		}
+		if f.ExternalID {
+			externalIDs = append(externalIDs, f.Name)
+		}
+	}
+	return nameField, externalIDs, nil
+}
+
+// get decodes the JSON response to GET path, relative to the versioned REST
+// API of the instance, into v.
+func (s *SalesforceConnector) get(ctx context.Context, path string, v interface{}) error {
+	u := s.instanceURL + "/services/data/v" + s.opts.APIVersion + path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &SalesforceConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+type SFTPConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+}
+
+type Options struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	User string `json:"user"`
+	// Password, PrivateKey (PEM) or PrivateKeyFile authenticate the user.
+	// Passphrase decrypts an encrypted private key.
+	Password       string `json:"password"`
+	PrivateKey     string `json:"private_key"`
+	PrivateKeyFile string `json:"private_key_file"`
+	Passphrase     string `json:"passphrase"`
+	// KnownHostsFile verifies the server host key and defaults to
+	// ~/.ssh/known_hosts. InsecureIgnoreHostKey disables the check.
+	KnownHostsFile        string `json:"known_hosts_file"`
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key"`
+	// Root is the remote directory walked, the login directory by
+	// default.
+	Root string `json:"root"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+func (s *SFTPConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		s.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Host == "" || opts.User == "" {
+		return errors.New("invalid options: host and user are required")
+	}
+	if opts.Port == 0 {
+		opts.Port = 22
+	}
+	if opts.Root == "" {
+		opts.Root = "."
+	}
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	config, err := clientConfig(opts)
+	if err != nil {
+		s.logger.Error("Failed to configure SSH client", "error", err)
+		return fmt.Errorf("failed to configure SSH client: %w", err)
+	}
+	addr := net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port))
+	conn, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		return fmt.Errorf("failed to start SFTP session: %w", err)
+	}
+	defer client.Close()
+
+	// Relative roots, the default included, are resolved so that the URIs
+	// hold absolute paths.
+	root, err := client.RealPath(opts.Root)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", opts.Root, err)
+	}
+	opts.Root = root
+
+	return s.walk(ctx, client, addr, opts, cb)
+}
+
+// clientConfig returns the SSH configuration for the authentication and host
+// key options.
+func clientConfig(opts Options) (*ssh.ClientConfig, error) {
+	var auth []ssh.AuthMethod
+	key := []byte(opts.PrivateKey)
+	if len(key) == 0 && opts.PrivateKeyFile != "" {
+		var err error
+		key, err = os.ReadFile(opts.PrivateKeyFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(key) > 0 {
+		var signer ssh.Signer
+		var err error
+		if opts.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(opts.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if opts.Password != "" {
+		auth = append(auth, ssh.Password(opts.Password))
+	}
+	if len(auth) == 0 {
+		return nil, errors.New("password, private_key or private_key_file is required")
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !opts.InsecureIgnoreHostKey {
+		knownHostsFile := opts.KnownHostsFile
+		if knownHostsFile == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+		}
+		var err error
+		hostKeyCallback, err = knownhosts.New(knownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load known hosts: %w", err)
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            opts.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+func (s *SFTPConnector) walk(ctx context.Context, client *sftp.Client, addr string, opts Options, cb plugin.CallbackHandler) error {
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+
+	w := client.Walk(opts.Root)
+	for w.Step() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := w.Err(); err != nil {
+			if w.Path() == opts.Root {
+				return err
+			}
+			s.logger.Warn("Failed to walk path", "path", w.Path(), "error", err)
+			continue
+		}
+		info := w.Stat()
+		if !info.Mode().IsRegular() {
+			continue
+		}
+
+		uri := (&url.URL{Scheme: "sftp", Host: addr, Path: w.Path()}).String()
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     uri,
+			ResourceName: w.Path(),
+			Uri:          uri,
+			Metadata: map[string]string{
+				"size":     strconv.FormatInt(info.Size(), 10),
+				"mod_time": info.ModTime().Format(time.RFC3339),
+			}})
+		if err != nil {
+			return err
+		}
+	}
+	return batch.Flush()
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &SFTPConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/pidanou/c1-core/pkg/plugin"
+	"github.com/pidanou/c1-core/pkg/plugin/proto"
+	"github.com/pidanou/c1-plugins/internal/pluginserve"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+type SnowflakeConnector struct {
+	logger hclog.Logger
+	ctx    context.Context
+}
+
+type Options struct {
+	// Account is the account identifier, such as myorg-myaccount.
+	Account   string `json:"account"`
+	User      string `json:"user"`
+	Database  string `json:"database"`
+	Warehouse string `json:"warehouse"`
+	Role      string `json:"role"`
+	// Password or PrivateKeyFile, an unencrypted PKCS#8 PEM key for key
+	// pair authentication, authenticate the user.
+	Password       string `json:"password"`
+	PrivateKeyFile string `json:"private_key_file"`
+	// Schemas restricts the catalog to these schemas, compared
+	// case-insensitively. INFORMATION_SCHEMA is always skipped.
+	Schemas []string `json:"schemas"`
+}
+
+// batchSize is the number of DataObjects sent per callback.
+const batchSize = 1000
+
+const tablesQuery = `
+SELECT table_catalog, table_schema, table_name, table_type, row_count, bytes
+FROM information_schema.tables
+WHERE table_schema <> 'INFORMATION_SCHEMA'%s
+ORDER BY table_schema, table_name`
+
+func (s *SnowflakeConnector) Sync(options string, cb plugin.CallbackHandler) error {
+	var opts Options
+
+	err := pluginserve.DecodeOptions(options, &opts)
+	if err != nil {
+		s.logger.Error("Failed to unmarshal options", "error", err)
+		return fmt.Errorf("failed to unmarshal options: %w", err)
+	}
+	if opts.Account == "" || opts.User == "" || opts.Database == "" {
+		return errors.New("invalid options: account, user and database are required")
+	}
+
+	ctx := s.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	config := &gosnowflake.Config{
+		Account:   opts.Account,
+		User:      opts.User,
+		Password:  opts.Password,
+		Database:  opts.Database,
+		Warehouse: opts.Warehouse,
+		Role:      opts.Role,
+	}
+	if opts.PrivateKeyFile != "" {
+		config.PrivateKey, err = readPrivateKey(opts.PrivateKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read private key: %w", err)
+		}
+		config.Authenticator = gosnowflake.AuthTypeJwt
+	}
+	db := sql.OpenDB(gosnowflake.NewConnector(gosnowflake.SnowflakeDriver{}, *config))
+	defer db.Close()
+
+	filter, args := schemaFilter(opts.Schemas)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(tablesQuery, filter), args...)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	batch := pluginserve.NewBatcher(ctx, cb, batchSize)
+	for rows.Next() {
+		var database, schema, table, tableType string
+		var rowCount, bytes sql.NullInt64
+		if err := rows.Scan(&database, &schema, &table, &tableType, &rowCount, &bytes); err != nil {
+			return fmt.Errorf("failed to read table: %w", err)
+		}
+		kind := "table"
+		if strings.Contains(tableType, "VIEW") {
+			kind = "view"
+		}
+		metadata := map[string]string{
+			"schema":     schema,
+			"table_type": tableType,
+			"type":       kind,
+		}
+		if rowCount.Valid {
+			metadata["row_count"] = strconv.FormatInt(rowCount.Int64, 10)
+		}
+		if bytes.Valid {
+			metadata["bytes"] = strconv.FormatInt(bytes.Int64, 10)
+		}
+		name := database + "." + schema + "." + table
+		err := batch.Add(&proto.DataObject{
+			RemoteId:     name,
+			ResourceName: name,
+			Uri:          fmt.Sprintf("snowflake://%s/%s/%s/%s", opts.Account, database, schema, table),
+			Metadata:     metadata})
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	return batch.Flush()
+}
+
+// schemaFilter returns the SQL condition and arguments restricting the query
+// to schemas, compared case-insensitively, none when it is empty.
+func schemaFilter(schemas []string) (string, []interface{}) {
+	if len(schemas) == 0 {
+		return "", nil
+	}
+	args := make([]interface{}, len(schemas))
+	for i, schema := range schemas {
+		args[i] = strings.ToUpper(schema)
+	}
+	return "\n  AND UPPER(table_schema) IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(schemas)), ", ") + ")", args
+}
+
+func readPrivateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not an RSA key")
+	}
+	return rsaKey, nil
+}
+
+func main() {
+	logger := pluginserve.NewLogger()
+
+	ctx, stop := pluginserve.SignalContext()
+	defer stop()
+
+	pluginserve.Serve(logger, &SnowflakeConnector{
+		logger: logger,
+		ctx:    ctx,
+	})
+}